@@ -2,6 +2,7 @@ package lex
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -14,19 +15,15 @@ import (
 type analyzeReq struct {
 	Code     string `json:"code"`
 	Filename string `json:"filename,omitempty"`
-}
-
-type tokenDTO struct {
-	Lexeme string      `json:"lexeme"`
-	Type   string      `json:"type"`
-	Line   int         `json:"line"`
-	Column int         `json:"column"`
-	Extra  interface{} `json:"extra,omitempty"`
+	Trivia   bool   `json:"trivia,omitempty"`
+	Edition  int    `json:"edition,omitempty"`
+	Indent   bool   `json:"indent,omitempty"`
 }
 
 type analyzeResp struct {
-	Tokens []tokenDTO `json:"tokens,omitempty"`
-	Error  string     `json:"error,omitempty"`
+	Tokens      []token.Token      `json:"tokens,omitempty"`
+	Diagnostics []lexer.Diagnostic `json:"diagnostics,omitempty"`
+	Error       string             `json:"error,omitempty"`
 }
 
 func analyzeHandler(w http.ResponseWriter, r *http.Request) {
@@ -60,25 +57,26 @@ func analyzeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	l := lexer.New(req.Code)
-	toks := l.Tokenize()
-
-	out := make([]tokenDTO, 0, len(toks))
-	for _, t := range toks {
-		// Skip NEWLINE tokens if desired - keep everything for now
-		typeName := token.TokenNames[t.Type]
-		if typeName == "" {
-			typeName = "UNKNOWN"
+	var opts []lexer.Option
+	if req.Edition != 0 {
+		if _, ok := token.ParseEdition(fmt.Sprint(req.Edition)); !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(analyzeResp{Error: fmt.Sprintf("unknown edition %d", req.Edition)})
+			return
 		}
-		out = append(out, tokenDTO{
-			Lexeme: t.Lexeme,
-			Type:   typeName,
-			Line:   t.Line,
-			Column: t.Column,
-		})
+		opts = append(opts, lexer.WithEdition(token.Edition(req.Edition)))
+	}
+	if req.Trivia {
+		opts = append(opts, lexer.WithTrivia())
+	}
+	if req.Indent {
+		opts = append(opts, lexer.WithIndentation())
 	}
+	l := lexer.New(req.Code, opts...)
 
-	resp := analyzeResp{Tokens: out}
+	// Tokens are sent as the lexer made them; their JSON form is the same as
+	// in token files, so there is nothing to convert
+	resp := analyzeResp{Tokens: l.Tokenize(), Diagnostics: l.Errors()}
 	json.NewEncoder(w).Encode(resp)
 }
 
@@ -0,0 +1,44 @@
+package lex
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"synta-compiler/token"
+)
+
+func TestAnalyzeEdition(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+		first  token.TokenType
+	}{
+		{`{"code": "true"}`, http.StatusOK, token.IDENTIFIER},
+		{`{"code": "true", "edition": 2026}`, http.StatusOK, token.TRUE},
+		{`{"code": "true", "edition": 9999}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		analyzeHandler(rec, httptest.NewRequest(http.MethodPost, "/api/analyze", strings.NewReader(tt.body)))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.body, rec.Code, tt.status)
+			continue
+		}
+		var resp analyzeResp
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v", tt.body, err)
+		}
+		if tt.status != http.StatusOK {
+			if resp.Error != "unknown edition 9999" {
+				t.Errorf("%s: error %q", tt.body, resp.Error)
+			}
+			continue
+		}
+		if len(resp.Tokens) == 0 || resp.Tokens[0].Type != tt.first {
+			t.Errorf("%s: got %v, want %v first", tt.body, resp.Tokens, tt.first)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package lexer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"synta-compiler/token"
+	"testing"
+)
+
+// benchSource concatenates the example programs into one input. The first
+// file's edition pragma stays the only one.
+func benchSource(b *testing.B) string {
+	b.Helper()
+	files, err := filepath.Glob("../examples/*.synta")
+	if err != nil || len(files) == 0 {
+		b.Fatal("no example files found")
+	}
+	var src strings.Builder
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		src.Write(data)
+		src.WriteByte('\n')
+	}
+	return src.String()
+}
+
+func benchmarkTokenize(b *testing.B, opts ...Option) {
+	src := benchSource(b)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for b.Loop() {
+		New(src, opts...).Tokenize()
+	}
+}
+
+func BenchmarkTokenize(b *testing.B)            { benchmarkTokenize(b) }
+func BenchmarkTokenizeTrivia(b *testing.B)      { benchmarkTokenize(b, WithTrivia()) }
+func BenchmarkTokenizeIndentation(b *testing.B) { benchmarkTokenize(b, WithIndentation()) }
+
+func BenchmarkScan(b *testing.B) {
+	src := benchSource(b)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	var buf []token.Offsets
+	for b.Loop() {
+		buf = New(src).Scan(buf[:0])
+	}
+}
+
+func BenchmarkRelex(b *testing.B) {
+	src := benchSource(b)
+	prev := New(src).Tokenize()
+	edit := Edit{Offset: len(src) / 2, Inserted: "x"}
+	next := edit.Apply(src)
+	b.SetBytes(int64(len(next)))
+	b.ReportAllocs()
+	for b.Loop() {
+		New(next).Relex(prev, nil, edit)
+	}
+}
@@ -0,0 +1,59 @@
+// lexer/diagnostic.go
+package lexer
+
+import "fmt"
+
+// Diagnostic codes reported by the lexer
+const (
+	ErrUnterminatedString  = "L001"
+	ErrUnterminatedComment = "L002"
+	ErrIllegalCharacter    = "L003"
+	ErrMissingDecorator    = "L004"
+	ErrUnterminatedInterp  = "L005"
+	ErrInvalidEscape       = "L006"
+	ErrMalformedNumber     = "L007"
+	ErrUnknownEdition      = "L008"
+	ErrIndentation         = "L009"
+	ErrInterpolationDepth  = "L010"
+)
+
+// Position is a location in the source: a byte offset plus 1-based line/column
+type Position struct {
+	Offset      int `json:"offset"`
+	Line        int `json:"line"`
+	Column      int `json:"column"`
+	UTF16Column int `json:"utf16_column"`
+}
+
+// Diagnostic is a lexical error with the source range it covers
+type Diagnostic struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Start   Position `json:"start"`
+	End     Position `json:"end"`
+	Hint    string   `json:"hint,omitempty"`
+}
+
+func (d Diagnostic) Error() string {
+	msg := fmt.Sprintf("Line %d:%d: [%s] %s", d.Start.Line, d.Start.Column, d.Code, d.Message)
+	if d.Hint != "" {
+		msg += " (" + d.Hint + ")"
+	}
+	return msg
+}
+
+// Errors returns the diagnostics collected during tokenization
+func (l *Lexer) Errors() []Diagnostic {
+	return l.errors
+}
+
+// report records a diagnostic spanning from start to the current position
+func (l *Lexer) report(code string, start position, message, hint string) {
+	l.errors = append(l.errors, Diagnostic{
+		Code:    code,
+		Message: message,
+		Start:   Position{Offset: start.offset, Line: start.line, Column: start.column, UTF16Column: start.utf16Column},
+		End:     Position{Offset: l.base + l.pos, Line: l.line, Column: l.column, UTF16Column: l.utf16Column},
+		Hint:    hint,
+	})
+}
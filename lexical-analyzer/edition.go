@@ -0,0 +1,98 @@
+// lexer/edition.go
+package lexer
+
+import (
+	"fmt"
+	"strings"
+	"synta-compiler/token"
+)
+
+// findPragma returns the byte offset of an `edition 2026` pragma that comes
+// before any token in input (only whitespace and comments may precede it),
+// or -1 if the file has none
+func findPragma(input string) int {
+	i := 0
+	for i < len(input) {
+		rest := input[i:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\n':
+			i++
+		case strings.HasPrefix(rest, "<!"):
+			end := strings.Index(rest[2:], "!>")
+			if end < 0 {
+				return -1
+			}
+			i += 2 + end + 2
+		case strings.HasPrefix(rest, "!>") && !strings.HasPrefix(rest, "!>>"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				return -1
+			}
+			i += end
+		default:
+			if n, _ := scanPragma(rest); n > 0 {
+				return i
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// scanPragma matches `edition <digits>` at the start of s and returns its
+// length and the digits
+func scanPragma(s string) (int, string) {
+	const keyword = "edition"
+	if !strings.HasPrefix(s, keyword) {
+		return 0, ""
+	}
+	i := len(keyword)
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	if i == len(keyword) {
+		return 0, ""
+	}
+	digits := i
+	for i < len(s) && isDecimalDigit(s[i]) {
+		i++
+	}
+	if i == digits || (i < len(s) && (isLetter(rune(s[i])) || s[i] == '_')) {
+		return 0, ""
+	}
+	return i, s[digits:i]
+}
+
+// readPragma lexes the file's edition pragma into an EDITION token whose
+// Value is the edition year
+func (l *Lexer) readPragma(start position) (token.TokenType, string) {
+	n, value := scanPragma(l.input[l.pos:])
+	for i := 0; i < n; i++ {
+		l.advance()
+	}
+	if _, ok := token.ParseEdition(value); !ok {
+		known := []string{}
+		for _, e := range token.Editions() {
+			known = append(known, fmt.Sprint(int(e)))
+		}
+		l.report(ErrUnknownEdition, start, fmt.Sprintf("unknown edition %s", value),
+			"known editions: "+strings.Join(known, ", "))
+	}
+	l.value = value
+	return token.EDITION, l.input[start.offset-l.base : l.pos]
+}
+
+// pragmaOf returns the offset of the pragma at the start of tokens and the
+// edition year it names, or -1 and "" if there is none
+func pragmaOf(tokens []token.Token) (int, string) {
+	for _, tok := range tokens {
+		switch tok.Type {
+		case token.NEWLINE, token.COMMENT_LINE, token.COMMENT_MULTI:
+			continue
+		case token.EDITION:
+			return tok.Span.Start.Offset, tok.Value
+		}
+		return -1, ""
+	}
+	return -1, ""
+}
@@ -4,7 +4,7 @@ import React, { useState, useEffect } from 'react'
 import EditorPane from './components/EditorPane'
 import OutputTable from './components/OutputTable'
 import { analyzeCode } from './api'
-import { TokenDTO } from './types'
+import { TokenDTO, DiagnosticDTO } from './types'
 
 // Define the possible output modes (added 'codeBlock')
 type ViewMode = 'table' | 'lineByLine' | 'singleLine' | 'codeBlock'
@@ -12,6 +12,7 @@ type ViewMode = 'table' | 'lineByLine' | 'singleLine' | 'codeBlock'
 function App() {
   const [code, setCode] = useState<string>('// type code here\n')
   const [tokens, setTokens] = useState<TokenDTO[]>([])
+  const [diagnostics, setDiagnostics] = useState<DiagnosticDTO[]>([])
   const [loading, setLoading] = useState(false)
   const [err, setErr] = useState<string | null>(null)
 
@@ -57,8 +58,9 @@ function App() {
     setLoading(true)
     setErr(null)
     try {
-      const tok = await analyzeCode(code)
-      setTokens(tok)
+      const result = await analyzeCode(code)
+      setTokens(result.tokens)
+      setDiagnostics(result.diagnostics)
       
       // Reset currentLine to 1 after a successful run
       setCurrentLine(1)
@@ -291,6 +293,7 @@ END
     // Also clear the editor
     setCode('')
     setTokens([])
+    setDiagnostics([])
     setCurrentLine(1)
     setErr(null)
   }
@@ -311,6 +314,7 @@ END
         const content = e.target?.result as string
         setCode(content)
         setTokens([])
+        setDiagnostics([])
         setCurrentLine(1)
         setErr(null)
       } catch (error) {
@@ -396,6 +400,12 @@ END
             </div>
             {/* END: Updated View Switcher UI */}
             {err && <div className="err">{err}</div>}
+            {diagnostics.map((d, i) => (
+              <div key={i} className="err">
+                {`Line ${d.start.line}:${d.start.column}: [${d.code}] ${d.message}`}
+                {d.hint && ` (${d.hint})`}
+              </div>
+            ))}
           </div>
           <div className="editor">
             <EditorPane 
@@ -1,6 +1,6 @@
-import { TokenDTO } from './types'
+import { AnalyzeResult } from './types'
 
-export async function analyzeCode(code: string): Promise<TokenDTO[]> {
+export async function analyzeCode(code: string): Promise<AnalyzeResult> {
   const res = await fetch('http://localhost:8080/api/analyze', {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
@@ -8,5 +8,5 @@ export async function analyzeCode(code: string): Promise<TokenDTO[]> {
   })
   const data = await res.json()
   if (!res.ok || data.error) throw new Error(data.error || 'analysis failed')
-  return data.tokens as TokenDTO[]
+  return { tokens: data.tokens || [], diagnostics: data.diagnostics || [] }
 }
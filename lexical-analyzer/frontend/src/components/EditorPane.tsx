@@ -109,7 +109,8 @@ export default function EditorPane({ code, setCode, tokens = [], onRun, theme =
       })
       .map(t => {
         const startLine = t.line
-        const startCol = Math.max(1, t.column)
+        // Monaco columns count UTF-16 code units, not runes
+        const startCol = Math.max(1, t.utf16_column ?? t.column)
         const tt = (t.type || '').toUpperCase()
         let endLine = startLine
         let endCol = startCol + Math.max(1, t.lexeme.length)
@@ -134,8 +135,8 @@ export default function EditorPane({ code, setCode, tokens = [], onRun, theme =
           }
         }
 
-        // Handle single-line comments: !> ...
-        if (tt === 'COMMENT_LINE') {
+        // Handle single-line and doc comments: !> ... and !>> ...
+        if (tt === 'COMMENT_LINE' || tt === 'DOC_COMMENT' || tt === 'SHELL_DIRECTIVE') {
           endCol = model.getLineContent(startLine).length + 1
         }
 
@@ -208,15 +209,16 @@ function mapTokenTypeToClass(type: string) {
     'DEBUG', 'CHECKPOINT', 'TRACE', 'ASSERT', 'CONFIGURE', 'GENERATE_REPORT',
     'AGENT', 'CORE', 'MODEL', 'TOOLS', 'ROLE', 'MODE', 'SYS_PROMPT', 'MAX_CONCURRENT_REQUESTS', 'RETRY_POLICY',
     'CREATE_POOL', 'MAX_WORKERS', 'SUBMIT', 'SUBMIT_DELAYED', 'JOIN', 'NOW', 'EXECUTION_TIME', 'REPORT',
+    'TRUE', 'FALSE', 'NULL',
   ])
   
   const t = (type || '').toUpperCase()
   
   if (keywords.has(t)) return 'tok-keyword'
   if (t.startsWith('AT_') || t === 'DECORATOR') return 'tok-keyword'
-  if (t === 'STRING') return 'tok-string'
-  if (t === 'INTEGER' || t === 'FLOAT') return 'tok-number'
-  if (t === 'COMMENT_LINE' || t === 'COMMENT_MULTI') return 'tok-comment'
+  if (t === 'STRING' || t === 'SHELL_DIRECTIVE') return 'tok-string'
+  if (t === 'INTEGER' || t === 'FLOAT' || t === 'DURATION') return 'tok-number'
+  if (t === 'COMMENT_LINE' || t === 'COMMENT_MULTI' || t === 'DOC_COMMENT') return 'tok-comment'
   if (t === 'STATEMENT_END') return 'tok-statement-end'
   if (t === 'ILLEGAL') return 'tok-illegal'
   if (['PLUS', 'MINUS', 'MULTIPLY', 'DIVIDE', 'MODULO', 'ARROW', 'FAT_ARROW'].includes(t)) return 'tok-operator'
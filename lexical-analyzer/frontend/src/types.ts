@@ -3,6 +3,58 @@ export type TokenDTO = {
   type: string
   line: number
   column: number
+  utf16_column?: number
   value?: string
-  extra?: Record<string, any>
+  span?: Span
+  raw?: string
+  leading_trivia?: Trivia[]
+  trailing_trivia?: Trivia[]
+  parts?: StringPart[]
+}
+
+export type Pos = {
+  offset: number
+  line: number
+  column: number
+}
+
+// Span is the byte-offset range a token covers in the source
+export type Span = {
+  start: Pos
+  end: Pos
+}
+
+// StringPart is a piece of an interpolated string: literal text, or the
+// tokens of a ${...} expression
+export type StringPart = {
+  text?: string
+  expr?: boolean
+  tokens?: TokenDTO[]
+  rejected?: boolean
+}
+
+// Trivia is whitespace or a comment kept by the lexer's lossless mode
+export type Trivia = {
+  type: string
+  text: string
+}
+
+export type Position = {
+  offset: number
+  line: number
+  column: number
+  utf16_column: number
+}
+
+export type DiagnosticDTO = {
+  code: string
+  message: string
+  start: Position
+  end: Position
+  hint?: string
+}
+
+export type AnalyzeResult = {
+  tokens: TokenDTO[]
+  diagnostics: DiagnosticDTO[]
 }
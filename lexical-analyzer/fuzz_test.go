@@ -0,0 +1,76 @@
+package lexer
+
+import (
+	"os"
+	"path/filepath"
+	"synta-compiler/token"
+	"testing"
+)
+
+// addExamples seeds f with the example programs
+func addExamples(f *testing.F) {
+	files, err := filepath.Glob("../examples/*.synta")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(src))
+	}
+	for _, src := range []string{"", "x := \"a${b}c\"", "<! open", "'''\n", "0x_1e+", "!pip x;\n", "if (a &&\n!b) {}", "with a:\n  b\n"} {
+		f.Add(src)
+	}
+}
+
+// FuzzTokenize checks that the lexer never panics, that its tokens are
+// ordered and don't overlap, and that lossless mode reproduces the input.
+// Large seeds make the fuzzer slow to minimize, so run it with e.g.
+// -fuzzminimizetime 5s.
+func FuzzTokenize(f *testing.F) {
+	addExamples(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		checkTokens(t, src, New(src).Tokenize())
+		checkTokens(t, src, New(src, WithIndentation()).Tokenize())
+
+		tokens := New(src, WithTrivia()).Tokenize()
+		checkTokens(t, src, tokens)
+		if got := token.Source(tokens); got != src {
+			t.Fatalf("lexemes and trivia don't reproduce the input:\n got %q\nwant %q", got, src)
+		}
+	})
+}
+
+// checkTokens verifies that tokens are in order, don't overlap, stay inside
+// src and end with a single EOF at the end of src
+func checkTokens(t *testing.T, src string, tokens []token.Token) {
+	t.Helper()
+	if len(tokens) == 0 || tokens[len(tokens)-1].Type != token.EOF {
+		t.Fatal("token stream doesn't end with EOF")
+	}
+	if end := tokens[len(tokens)-1].Span.End.Offset; end != len(src) {
+		t.Fatalf("EOF at offset %d, want %d", end, len(src))
+	}
+	checkSpans(t, tokens, 0, len(src))
+}
+
+func checkSpans(t *testing.T, tokens []token.Token, start, end int) {
+	t.Helper()
+	prev := start
+	for i, tok := range tokens {
+		span := tok.Span
+		if span.Start.Offset < prev || span.End.Offset < span.Start.Offset || span.End.Offset > end {
+			t.Fatalf("token %d (%s %q) spans [%d, %d), previous token ended at %d",
+				i, tok.Type, tok.Lexeme, span.Start.Offset, span.End.Offset, prev)
+		}
+		if tok.Type == token.EOF && i != len(tokens)-1 {
+			t.Fatalf("EOF at token %d of %d", i, len(tokens))
+		}
+		for _, part := range tok.Parts {
+			checkSpans(t, part.Tokens, span.Start.Offset, span.End.Offset)
+		}
+		prev = span.End.Offset
+	}
+}
@@ -0,0 +1,227 @@
+// lexer/incremental.go
+package lexer
+
+import (
+	"strings"
+	"synta-compiler/token"
+)
+
+// maxLookahead is how many bytes past the end of a token the lexer may
+// inspect while deciding where the token ends (e.g. the "e+5" of 1e+5).
+// Shell directives are the exception, see reach.
+const maxLookahead = 4
+
+// Edit is a change to the source text: Deleted bytes starting at Offset were
+// replaced by Inserted
+type Edit struct {
+	Offset   int    `json:"offset"`
+	Deleted  int    `json:"deleted"`
+	Inserted string `json:"inserted"`
+}
+
+// Apply returns src with the edit applied
+func (e Edit) Apply(src string) string {
+	return src[:e.Offset] + e.Inserted + src[e.Offset+e.Deleted:]
+}
+
+// Relex lexes the lexer's input, which is the source after edit, reusing
+// prev and prevErrors (the tokens and diagnostics of the source before the
+// edit). Only the damaged region is lexed again: tokens in front of it are
+// kept, and once the new token stream starts a token at the same place as
+// an old one, the rest of the old stream is shifted into place.
+//
+// The tokens returned, and Errors() afterwards, are the same as a full
+// Tokenize of the new input. If prev doesn't match the edit, Relex falls
+// back to a full Tokenize, as it always does in indentation mode, where
+// any line can open or close blocks further down.
+func (l *Lexer) Relex(prev []token.Token, prevErrors []Diagnostic, edit Edit) []token.Token {
+	if len(prev) == 0 || prev[len(prev)-1].Type != token.EOF || l.pos != 0 || l.indent != nil {
+		return l.Tokenize()
+	}
+	oldLen := prev[len(prev)-1].Span.End.Offset
+	delta := len(edit.Inserted) - edit.Deleted
+	if edit.Offset < 0 || edit.Deleted < 0 || edit.Offset+edit.Deleted > oldLen || len(l.input) != oldLen+delta {
+		return l.Tokenize()
+	}
+
+	// A different edition pragma changes what every identifier lexes as, and
+	// an old pragma token must not be reused once it has stopped being one
+	newPragma := ""
+	if l.pragmaAt >= 0 {
+		_, newPragma = scanPragma(l.input[l.pragmaAt:])
+	}
+	oldAt, oldPragma := pragmaOf(prev)
+	if oldAt >= edit.Offset+edit.Deleted {
+		oldAt += delta
+	} else if oldAt >= edit.Offset {
+		oldAt = -2 // edited away
+	}
+	if oldAt != l.pragmaAt || oldPragma != newPragma {
+		return l.Tokenize()
+	}
+
+	// Find the first token whose lexing could have looked at the edited
+	// bytes, then back up to a token the lexer can resume from
+	k := 0
+	for k < len(prev)-1 && l.reach(prev[k], edit.Offset) < edit.Offset {
+		k++
+	}
+	r := k - 1
+	for r > 0 && len(prev[r].LeadingTrivia) > 0 {
+		r--
+	}
+	if r > 0 {
+		for _, tok := range prev[:r] {
+			l.stmt.next(tok.Type)
+		}
+		resume := prev[r]
+		l.pos = resume.Span.Start.Offset
+		l.line, l.column, l.utf16Column = resume.Line, resume.Column, resume.UTF16Column
+	} else {
+		r = 0
+	}
+	l.tokens = append(make([]token.Token, 0, len(prev)+len(edit.Inserted)/bytesPerToken+1), prev[:r]...)
+	for _, d := range prevErrors {
+		if d.Start.Offset < l.pos {
+			l.errors = append(l.errors, d)
+		}
+	}
+
+	// Lex until a new token lines up with an old one past the edit
+	damageEnd := edit.Offset + len(edit.Inserted)
+	oldDamageEnd := edit.Offset + edit.Deleted
+	j := r
+	old := l.stmt // the statement state of the old stream in front of prev[j]
+	for {
+		reported := len(l.errors)
+		tok := l.NextToken()
+		if start := tok.Span.Start.Offset; start >= damageEnd && len(tok.LeadingTrivia) == 0 {
+			for j < len(prev) && prev[j].Span.Start.Offset+delta < start {
+				old.next(prev[j].Type)
+				j++
+			}
+			// Directives look back to the start of their line and depend on
+			// the statement around them, so the token itself and the state
+			// after it must also match before the old stream can be reused
+			if j < len(prev) && prev[j].Span.Start.Offset+delta == start &&
+				prev[j].Span.Start.Offset >= oldDamageEnd && len(prev[j].LeadingTrivia) == 0 &&
+				prev[j].Type == tok.Type && prev[j].Lexeme == tok.Lexeme && old.after(tok.Type) == l.stmt {
+				l.errors = l.errors[:reported] // the old diagnostics cover tok
+				l.resync(prev[j:], prevErrors, tok, prev[j])
+				return l.tokens
+			}
+		}
+		l.tokens = append(l.tokens, tok)
+		if tok.Type == token.EOF {
+			return l.tokens
+		}
+	}
+}
+
+// reach returns the offset up to which the lexer may have looked while
+// lexing tok. A shell directive reads to the end of its line before
+// giving back a trailing ';' and blanks, so it depends on the whole line.
+// The input in front of offset is the same before and after the edit, so
+// the line end can be found in the edited input as long as it comes first.
+func (l *Lexer) reach(tok token.Token, offset int) int {
+	end := scanEnd(tok)
+	if tok.Type != token.SHELL_DIRECTIVE {
+		return end + maxLookahead
+	}
+	if end >= offset {
+		return end
+	}
+	if nl := strings.IndexByte(l.input[end:offset], '\n'); nl >= 0 {
+		return end + nl
+	}
+	return offset
+}
+
+// scanEnd returns the offset the lexer had reached after producing tok,
+// trailing trivia included
+func scanEnd(tok token.Token) int {
+	end := tok.Span.End.Offset
+	for _, tr := range tok.TrailingTrivia {
+		end += len(tr.Text)
+	}
+	return end
+}
+
+// resync appends the old tokens in tail, and the old diagnostics from the
+// same region, moved from where tail[0] was (old) to where it is now (cur)
+func (l *Lexer) resync(tail []token.Token, prevErrors []Diagnostic, cur, old token.Token) {
+	s := shift{
+		line:        old.Line,
+		offset:      cur.Span.Start.Offset - old.Span.Start.Offset,
+		lines:       cur.Line - old.Line,
+		columns:     cur.Column - old.Column,
+		utf16Column: cur.UTF16Column - old.UTF16Column,
+	}
+	for _, tok := range tail {
+		l.tokens = append(l.tokens, s.token(tok))
+	}
+	for _, d := range prevErrors {
+		if d.Start.Offset >= old.Span.Start.Offset {
+			d.Start, d.End = s.position(d.Start), s.position(d.End)
+			l.errors = append(l.errors, d)
+		}
+	}
+
+	eof := l.tokens[len(l.tokens)-1]
+	l.pos = len(l.input)
+	l.line, l.column, l.utf16Column = eof.Line, eof.Column, eof.UTF16Column
+}
+
+// shift moves positions after an edit. Positions on the line where the
+// shift starts also move sideways; later lines only move down.
+type shift struct {
+	line        int // line the shift starts on, before the edit
+	offset      int
+	lines       int
+	columns     int
+	utf16Column int
+}
+
+func (s shift) pos(p token.Pos) token.Pos {
+	if p.Line == s.line {
+		p.Column += s.columns
+	}
+	p.Offset += s.offset
+	p.Line += s.lines
+	return p
+}
+
+func (s shift) position(p Position) Position {
+	if p.Line == s.line {
+		p.Column += s.columns
+		p.UTF16Column += s.utf16Column
+	}
+	p.Offset += s.offset
+	p.Line += s.lines
+	return p
+}
+
+func (s shift) token(tok token.Token) token.Token {
+	if tok.Line == s.line {
+		tok.Column += s.columns
+		tok.UTF16Column += s.utf16Column
+	}
+	tok.Line += s.lines
+	tok.Span = token.Span{Start: s.pos(tok.Span.Start), End: s.pos(tok.Span.End)}
+
+	if tok.Parts != nil {
+		parts := make([]token.StringPart, len(tok.Parts))
+		for i, part := range tok.Parts {
+			if part.Tokens != nil {
+				tokens := make([]token.Token, len(part.Tokens))
+				for n, t := range part.Tokens {
+					tokens[n] = s.token(t)
+				}
+				part.Tokens = tokens
+			}
+			parts[i] = part
+		}
+		tok.Parts = parts
+	}
+	return tok
+}
@@ -0,0 +1,116 @@
+// lexer/indent.go
+package lexer
+
+import "synta-compiler/token"
+
+// indentState tracks the blocks opened by indentation in indentation mode
+type indentState struct {
+	stack     []int         // indentation widths of open blocks, innermost last
+	pending   []token.Token // tokens ready to be returned, in order
+	colon     bool          // the last token so far on this line was a ':'
+	lineStart bool          // the next token is the first on its line
+	nesting   int           // open (, [ and {, inside which indentation is ignored
+}
+
+// WithIndentation turns on indentation mode: a line ending in ':' that is
+// followed by a more indented line opens a block, marked by an INDENT token
+// before the first token of that line. Lines indented less than an open
+// block close it with a DEDENT, and EOF closes any that are still open.
+// Indentation inside brackets and braces is ignored, so brace-delimited
+// code is unaffected.
+func WithIndentation() Option {
+	return func(l *Lexer) { l.indent = &indentState{lineStart: true} }
+}
+
+// nextIndented is NextToken for indentation mode
+func (l *Lexer) nextIndented() token.Token {
+	st := l.indent
+	if len(st.pending) == 0 {
+		tok := l.next()
+		switch tok.Type {
+		case token.NEWLINE:
+			st.lineStart = st.nesting == 0
+		case token.COMMENT_LINE, token.COMMENT_MULTI, token.DOC_COMMENT:
+		case token.EOF:
+			for range st.stack {
+				st.pending = append(st.pending, indentToken(token.DEDENT, tok))
+			}
+			st.stack = nil
+		default:
+			if st.lineStart {
+				l.indentLine(tok)
+				st.lineStart = false
+			}
+			switch tok.Type {
+			case token.LPAREN, token.LBRACKET, token.LBRACE:
+				st.nesting++
+			case token.RPAREN, token.RBRACKET, token.RBRACE:
+				if st.nesting > 0 {
+					st.nesting--
+				}
+			}
+			st.colon = tok.Type == token.COLON && st.nesting == 0
+		}
+		st.pending = append(st.pending, tok)
+	}
+
+	// Shift the queue down rather than reslicing it, so its array is reused
+	tok := st.pending[0]
+	st.pending = st.pending[:copy(st.pending, st.pending[1:])]
+	return tok
+}
+
+// indentLine queues the INDENT or DEDENT tokens that go before tok, the
+// first token on its line
+func (l *Lexer) indentLine(tok token.Token) {
+	st := l.indent
+	width := tok.Column - 1
+	top := 0
+	if len(st.stack) > 0 {
+		top = st.stack[len(st.stack)-1]
+	}
+
+	if st.colon {
+		st.colon = false
+		if width > top {
+			st.stack = append(st.stack, width)
+			st.pending = append(st.pending, indentToken(token.INDENT, tok))
+			return
+		}
+		l.reportAt(tok, "expected an indented block after ':'", "indent the lines that belong to the block")
+	}
+
+	closed := false
+	for len(st.stack) > 0 && width < st.stack[len(st.stack)-1] {
+		st.stack = st.stack[:len(st.stack)-1]
+		st.pending = append(st.pending, indentToken(token.DEDENT, tok))
+		closed = true
+	}
+	if !closed {
+		return
+	}
+	level := 0 // the top level, once every block is closed
+	if len(st.stack) > 0 {
+		level = st.stack[len(st.stack)-1]
+	}
+	if width != level {
+		l.reportAt(tok, "unindent does not match any outer indentation level", "")
+	}
+}
+
+// indentToken makes a zero-width INDENT or DEDENT token in front of tok
+func indentToken(tokenType token.TokenType, tok token.Token) token.Token {
+	return token.Token{
+		Type:        tokenType,
+		Line:        tok.Line,
+		Column:      tok.Column,
+		UTF16Column: tok.UTF16Column,
+		Span:        token.Span{Start: tok.Span.Start, End: tok.Span.Start},
+	}
+}
+
+// reportAt records an indentation diagnostic at the start of tok
+func (l *Lexer) reportAt(tok token.Token, message, hint string) {
+	pos := Position{Offset: tok.Span.Start.Offset, Line: tok.Line, Column: tok.Column, UTF16Column: tok.UTF16Column}
+	l.errors = append(l.errors, Diagnostic{Code: ErrIndentation, Message: message, Start: pos, End: pos, Hint: hint})
+}
@@ -2,28 +2,106 @@
 package lexer
 
 import (
+	"fmt"
+	"io"
+	"strings"
 	"synta-compiler/token"
 	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
-	input  string
-	pos    int
-	line   int
-	column int
-	tokens []token.Token
+	input       string
+	base        int // byte offset of input within the enclosing source
+	pos         int
+	line        int
+	column      int // in runes
+	utf16Column int // in UTF-16 code units, for editors
+	tokens      []token.Token
+	errors      []Diagnostic
+	trivia      []token.Trivia // backing store for the tokens' trivia slices
+	lossless    bool           // keep whitespace and comments as trivia on tokens
+	edition     token.Edition
+	pragmaAt    int          // byte offset of the file's edition pragma, or -1
+	indent      *indentState // nil unless in indentation mode
+	depth       int          // how many ${...} interpolations enclose input
+	compact     bool         // lexing for Scan, which needs no decoded values
+	stmt        statementState
+
+	// The token being lexed: where it starts, and the decoded value and
+	// string parts that scan copies onto its Token
+	start position
+	value string
+	parts []token.StringPart
 }
 
-func New(input string) *Lexer {
-	return &Lexer{
-		input:  input,
-		pos:    0,
-		line:   1,
-		column: 1,
-		tokens: []token.Token{},
+// Option configures a Lexer
+type Option func(*Lexer)
+
+// WithTrivia puts the lexer in lossless mode: whitespace and comments are
+// attached to the surrounding tokens as trivia instead of being dropped or
+// emitted as COMMENT tokens, and token.Source(tokens) reproduces the input
+// byte for byte.
+func WithTrivia() Option {
+	return func(l *Lexer) { l.lossless = true }
+}
+
+// WithEdition selects the keyword set for files that don't start with an
+// `edition` pragma. Without it the lexer uses token.DefaultEdition.
+func WithEdition(edition token.Edition) Option {
+	return func(l *Lexer) { l.edition = edition }
+}
+
+// position is a snapshot of where a token starts
+type position struct {
+	offset      int
+	line        int
+	column      int
+	utf16Column int
+}
+
+func New(input string, opts ...Option) *Lexer {
+	l := &Lexer{
+		input:       input,
+		pos:         0,
+		line:        1,
+		column:      1,
+		utf16Column: 1,
+		errors:      []Diagnostic{},
+		edition:     token.DefaultEdition,
+		pragmaAt:    -1,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	// A pragma in the file overrides the configured edition
+	if at := findPragma(input); at >= 0 {
+		l.pragmaAt = at
+		if _, value := scanPragma(input[at:]); value != "" {
+			if edition, ok := token.ParseEdition(value); ok {
+				l.edition = edition
+			}
+		}
+	}
+	return l
+}
+
+// NewReader reads all of r and returns a lexer over its contents
+func NewReader(r io.Reader, opts ...Option) (*Lexer, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return New(string(data), opts...), nil
+}
+
+func (l *Lexer) mark() position {
+	return position{offset: l.base + l.pos, line: l.line, column: l.column, utf16Column: l.utf16Column}
 }
 
+// peek returns the byte at offset from the current position. Only use it to
+// compare against ASCII; use peekRune to classify characters.
 func (l *Lexer) peek(offset int) byte {
 	pos := l.pos + offset
 	if pos >= len(l.input) {
@@ -32,93 +110,209 @@ func (l *Lexer) peek(offset int) byte {
 	return l.input[pos]
 }
 
-func (l *Lexer) advance() byte {
+// peekRune decodes the rune at the current position
+func (l *Lexer) peekRune() rune {
 	if l.pos >= len(l.input) {
 		return 0
 	}
-	ch := l.input[l.pos]
-	l.pos++
-	if ch == '\n' {
+	r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+	return r
+}
+
+func (l *Lexer) advance() rune {
+	if l.pos >= len(l.input) {
+		return 0
+	}
+	r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+	l.pos += size
+	if r == '\n' {
 		l.line++
 		l.column = 1
+		l.utf16Column = 1
 	} else {
 		l.column++
+		l.utf16Column += utf16Len(r)
+	}
+	return r
+}
+
+// utf16Len returns how many UTF-16 code units encode r
+func utf16Len(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
 	}
-	return ch
+	return 1
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
 }
 
 func (l *Lexer) skipWhitespace() {
-	for l.pos < len(l.input) && unicode.IsSpace(rune(l.input[l.pos])) && l.input[l.pos] != '\n' {
-		l.advance()
+	for l.pos < len(l.input) {
+		if ch := l.input[l.pos]; ch == ' ' || ch == '\t' || ch == '\r' {
+			l.skipASCII()
+		} else if ch == '\n' || !unicode.IsSpace(l.peekRune()) {
+			return
+		} else {
+			l.advance()
+		}
 	}
 }
 
 func (l *Lexer) readIdentifier() string {
 	start := l.pos
-	for l.pos < len(l.input) && (unicode.IsLetter(rune(l.input[l.pos])) ||
-		unicode.IsDigit(rune(l.input[l.pos])) || l.input[l.pos] == '_') {
+	for l.pos < len(l.input) {
+		if isASCIIWordByte(l.input[l.pos]) {
+			l.skipASCII()
+			continue
+		}
+		r := l.peekRune()
+		if !isLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
 		l.advance()
 	}
 	return l.input[start:l.pos]
 }
 
+// skipASCII is advance for a byte known to be ASCII other than '\n', the
+// common case in the lexer's inner loops
+func (l *Lexer) skipASCII() {
+	l.pos++
+	l.column++
+	l.utf16Column++
+}
+
+func isASCIIWordByte(ch byte) bool {
+	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') || ch == '_'
+}
+
+// numberBase describes a prefixed integer literal such as 0x1F
+type numberBase struct {
+	name    string
+	isDigit func(byte) bool
+}
+
+var numberBases = map[byte]numberBase{
+	'x': {"hexadecimal", isHexDigit},
+	'b': {"binary", func(ch byte) bool { return ch == '0' || ch == '1' }},
+	'o': {"octal", func(ch byte) bool { return '0' <= ch && ch <= '7' }},
+}
+
+func isDecimalDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
 func (l *Lexer) readNumber() (string, token.TokenType) {
+	mark := l.mark()
 	start := l.pos
 	tokenType := token.INTEGER
 
-	// Read integer part
-	for l.pos < len(l.input) && unicode.IsDigit(rune(l.input[l.pos])) {
-		l.advance()
+	// Prefixed integers: 0x1F, 0b1010, 0o755
+	if l.input[l.pos] == '0' {
+		if base, ok := numberBases[l.peek(1)|0x20]; ok {
+			l.advance() // 0
+			l.advance() // x, b or o
+			digits := l.pos
+			l.readDigits(mark, base.isDigit)
+			if l.pos == digits {
+				l.report(ErrMalformedNumber, mark, fmt.Sprintf("%s literal has no digits", base.name),
+					"write e.g. 0x1F, 0b1010 or 0o755")
+			}
+			if next := l.peekRune(); isLetter(next) || isDigit(next) {
+				bad := l.pos
+				l.readIdentifier()
+				l.report(ErrMalformedNumber, mark, fmt.Sprintf("invalid digit %q in %s literal", l.input[bad], base.name), "")
+			}
+			return l.input[start:l.pos], token.INTEGER
+		}
 	}
 
+	// Read integer part
+	l.readDigits(mark, isDecimalDigit)
+
 	// Check for decimal point
 	if l.pos < len(l.input) && l.input[l.pos] == '.' &&
-		l.pos+1 < len(l.input) && unicode.IsDigit(rune(l.input[l.pos+1])) {
+		l.pos+1 < len(l.input) && isDigit(rune(l.input[l.pos+1])) {
 		tokenType = token.FLOAT
 		l.advance() // consume '.'
 
 		// Read fractional part
-		for l.pos < len(l.input) && unicode.IsDigit(rune(l.input[l.pos])) {
-			l.advance()
+		l.readDigits(mark, isDecimalDigit)
+	}
+
+	// Scientific notation: 2e-4, 1.5E+3
+	if ch := l.peek(0); ch == 'e' || ch == 'E' {
+		sign := 0
+		if l.peek(1) == '+' || l.peek(1) == '-' {
+			sign = 1
+		}
+		if isDecimalDigit(l.peek(1 + sign)) {
+			tokenType = token.FLOAT
+			l.advance() // e
+			if sign == 1 {
+				l.advance() // + or -
+			}
+			l.readDigits(mark, isDecimalDigit)
 		}
 	}
 
-	// Handle scientific notation or time suffixes (s, m, h)
-	if l.pos < len(l.input) {
-		ch := l.input[l.pos]
-		if ch == 's' || ch == 'm' || ch == 'h' {
-			l.advance() // consume time suffix
+	// Time unit suffixes turn the number into a duration: 500ms, 1.5h
+	if unit := l.durationUnit(); unit != "" {
+		for range unit {
+			l.advance()
 		}
+		tokenType = token.DURATION
 	}
 
 	return l.input[start:l.pos], tokenType
 }
 
-func (l *Lexer) readString() string {
-	quote := l.advance() // consume opening quote
-	start := l.pos
-
-	for l.pos < len(l.input) && l.input[l.pos] != quote {
-		if l.input[l.pos] == '\\' && l.pos+1 < len(l.input) {
-			l.advance() // consume backslash
-			l.advance() // consume escaped character
-		} else {
-			l.advance()
+// readDigits reads a run of digits accepted by isDigit, allowing single '_'
+// separators between digits as in 1_000_000
+func (l *Lexer) readDigits(start position, isDigit func(byte) bool) {
+	for l.pos < len(l.input) {
+		ch := l.input[l.pos]
+		if ch == '_' {
+			if !isDigit(l.peek(1)) {
+				l.advance()
+				l.report(ErrMalformedNumber, start, "misplaced digit separator '_'",
+					"underscores must sit between digits, as in 1_000_000")
+				continue
+			}
+		} else if !isDigit(ch) {
+			return
 		}
+		l.advance()
 	}
+}
 
-	str := l.input[start:l.pos]
-	if l.pos < len(l.input) {
-		l.advance() // consume closing quote
+// durationUnit returns the duration unit at the current position, if the
+// unit is not just the start of a longer identifier
+func (l *Lexer) durationUnit() string {
+	for _, unit := range token.DurationUnits {
+		if strings.HasPrefix(l.input[l.pos:], unit) {
+			next := l.peek(len(unit))
+			if next == '_' || isDigit(rune(next)) || isLetter(rune(next)) {
+				return ""
+			}
+			return unit
+		}
 	}
-	return str
+	return ""
 }
 
-// Synta single-line comment: !>
-func (l *Lexer) readLineComment() string {
-	// consume the comment marker '!>' then capture the comment text
-	l.advance() // !
-	l.advance() // >
+// Synta single-line comment: !> (or !>> for doc comments)
+func (l *Lexer) readLineComment(marker string) string {
+	// consume the comment marker then capture the comment text
+	for range marker {
+		l.advance()
+	}
 
 	start := l.pos
 	for l.pos < len(l.input) && l.input[l.pos] != '\n' {
@@ -130,6 +324,7 @@ func (l *Lexer) readLineComment() string {
 
 // Synta multi-line comment: <! !>
 func (l *Lexer) readMultiComment() string {
+	mark := l.mark()
 	start := l.pos
 	l.advance() // <
 	l.advance() // !
@@ -144,272 +339,503 @@ func (l *Lexer) readMultiComment() string {
 	}
 
 	// If we reach here, comment wasn't closed properly
+	l.report(ErrUnterminatedComment, mark, "unterminated multi-line comment",
+		"close the comment with `!>`")
 	return l.input[start:l.pos]
 }
 
-func (l *Lexer) addToken(tokenType token.TokenType, lexeme string, line, column int) {
-	l.tokens = append(l.tokens, token.Token{
-		Type:   tokenType,
-		Lexeme: lexeme,
-		Line:   line,
-		Column: column,
-	})
+// atLineStart reports whether only spaces and tabs come before the current
+// position on its line. Interpolated expressions never start a line.
+func (l *Lexer) atLineStart() bool {
+	if l.base != 0 {
+		return false
+	}
+	for i := l.pos - 1; i >= 0; i-- {
+		switch l.input[i] {
+		case ' ', '\t', '\r':
+			continue
+		case '\n':
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// statementState is what the lexer knows about the statement it is in,
+// which decides whether a line-leading '!' starts a shell directive or is a
+// NOT on a continuation line, as in `if (ready &&\n!done)`
+type statementState struct {
+	brackets  int  // open ( and [
+	continued bool // the last token needs an operand after it, like && or ,
 }
 
-func (l *Lexer) Tokenize() []token.Token {
-	for l.pos < len(l.input) {
-		l.skipWhitespace()
-		if l.pos >= len(l.input) {
-			break
+// next moves the state past a token of type t
+func (s *statementState) next(t token.TokenType) {
+	switch t {
+	case token.NEWLINE, token.EOF, token.COMMENT_LINE, token.COMMENT_MULTI, token.DOC_COMMENT:
+		return
+	case token.LPAREN, token.LBRACKET:
+		s.brackets++
+	case token.RPAREN, token.RBRACKET:
+		if s.brackets > 0 {
+			s.brackets--
 		}
+	}
+	s.continued = t >= token.PLUS && t <= token.PIPE_OP && t != token.INCREMENT && t != token.DECREMENT ||
+		t == token.COMMA || t == token.DOT
+}
 
-		line, column := l.line, l.column
-		ch := l.peek(0)
+// after returns the state past a token of type t
+func (s statementState) after(t token.TokenType) statementState {
+	s.next(t)
+	return s
+}
 
-		// Handle Synta comments first (must be checked before < and ! operators)
-		if ch == '<' && l.peek(1) == '!' {
-			text := l.readMultiComment()
-			l.addToken(token.COMMENT_MULTI, text, line, column)
-			continue
+// atStart reports whether the next token starts a statement
+func (s statementState) atStart() bool {
+	return s.brackets == 0 && !s.continued
+}
+
+// readDirective reads a shell directive up to the end of its line, following
+// backslash line continuations. A trailing ';' is left for the parser. The
+// token's Value is the command with the '!' and continuations removed.
+func (l *Lexer) readDirective() (token.TokenType, string) {
+	begin := l.pos
+	end := begin
+	for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+		if l.input[l.pos] == '\\' && l.peek(1) == '\n' {
+			l.advance() // backslash
 		}
+		l.advance()
+		if ch := l.input[l.pos-1]; ch != ' ' && ch != '\t' && ch != '\r' {
+			end = l.pos
+		}
+	}
+	if l.input[end-1] == ';' {
+		end--
+	}
 
-		if ch == '!' && l.peek(1) == '>' {
-			text := l.readLineComment()
-			l.addToken(token.COMMENT_LINE, text, line, column)
-			continue
+	// Give back anything after the command (the ';' and trailing blanks)
+	for l.pos > end {
+		l.pos--
+		l.column--
+		l.utf16Column--
+	}
+
+	if !l.compact {
+		l.value = strings.ReplaceAll(l.input[begin+1:end], "\\\n", "")
+	}
+	return token.SHELL_DIRECTIVE, l.input[begin:end]
+}
+
+func (l *Lexer) makeToken(tokenType token.TokenType, lexeme string, start position) token.Token {
+	return token.Token{
+		Type:        tokenType,
+		Lexeme:      lexeme,
+		Line:        start.line,
+		Column:      start.column,
+		UTF16Column: start.utf16Column,
+		Span: token.Span{
+			Start: token.Pos{Offset: start.offset, Line: start.line, Column: start.column},
+			End:   token.Pos{Offset: l.base + l.pos, Line: l.line, Column: l.column},
+		},
+	}
+}
+
+// bytesPerToken is a low estimate of the average token length in Synta
+// source, used to size the token buffer up front
+const bytesPerToken = 5
+
+// Tokenize lexes the whole input and returns every token, ending with EOF
+func (l *Lexer) Tokenize() []token.Token {
+	if l.tokens == nil {
+		l.tokens = make([]token.Token, 0, len(l.input)/bytesPerToken+1)
+	}
+	for {
+		tok := l.NextToken()
+		l.tokens = append(l.tokens, tok)
+		if tok.Type == token.EOF {
+			return l.tokens
 		}
+	}
+}
 
-		// Handle @ decorators
-		if ch == '@' {
-			l.advance()
-			if unicode.IsLetter(rune(l.peek(0))) {
-				ident := l.readIdentifier()
-				switch ident {
-				case "agent":
-					l.addToken(token.AT_AGENT, "@agent", line, column)
-				case "task":
-					l.addToken(token.AT_TASK, "@task", line, column)
-				case "step":
-					l.addToken(token.AT_STEP, "@step", line, column)
-				case "intent":
-					l.addToken(token.AT_INTENT, "@intent", line, column)
-				case "explain":
-					l.addToken(token.AT_EXPLAIN, "@explain", line, column)
-				default:
-					l.addToken(token.DECORATOR, "@"+ident, line, column)
-				}
-			} else {
-				l.addToken(token.ILLEGAL, "@", line, column)
+// Scan lexes the rest of the input like Tokenize, but appends the tokens
+// to dst in compact form and returns the extended slice. Offsets come
+// straight from the scanner: no token.Token is built and string literals
+// are only checked, not decoded, so when dst is reused between inputs
+// lexing allocates only for diagnostics. Trivia and
+// indentation are worked out on Tokens, so in those modes Scan compacts
+// the output of NextToken instead.
+func (l *Lexer) Scan(dst []token.Offsets) []token.Offsets {
+	if l.lossless || l.indent != nil {
+		for {
+			tok := l.NextToken()
+			dst = append(dst, token.Offsets{Type: tok.Type, Start: int32(tok.Span.Start.Offset), End: int32(tok.Span.End.Offset)})
+			if tok.Type == token.EOF {
+				return dst
 			}
-			continue
 		}
-
-		// Handle identifiers and keywords
-		if unicode.IsLetter(rune(ch)) || ch == '_' {
-			ident := l.readIdentifier()
-			l.addToken(token.LookupIdent(ident), ident, line, column)
-			continue
+	}
+	l.compact = true
+	defer func() { l.compact = false }()
+	for {
+		tokenType, _ := l.lex()
+		dst = append(dst, token.Offsets{Type: tokenType, Start: int32(l.start.offset), End: int32(l.base + l.pos)})
+		if tokenType == token.EOF {
+			return dst
 		}
+	}
+}
 
-		// Handle numbers
-		if unicode.IsDigit(rune(ch)) {
-			num, tokenType := l.readNumber()
-			l.addToken(tokenType, num, line, column)
-			continue
-		}
+// NextToken lexes and returns the next token. Once the input is exhausted it
+// keeps returning EOF.
+func (l *Lexer) NextToken() token.Token {
+	if l.indent != nil {
+		return l.nextIndented()
+	}
+	return l.next()
+}
 
-		// Handle strings
-		if ch == '"' || ch == '\'' {
-			str := l.readString()
-			l.addToken(token.STRING, str, line, column)
-			continue
+// next lexes the next token along with its trivia in lossless mode
+func (l *Lexer) next() token.Token {
+	if !l.lossless {
+		return l.scan()
+	}
+
+	leading := l.readTrivia()
+	tok := l.scan()
+	tok.LeadingTrivia = leading
+	if tok.Type != token.NEWLINE && tok.Type != token.EOF {
+		tok.TrailingTrivia = l.readTrivia()
+	}
+	if raw := l.input[tok.Span.Start.Offset-l.base : tok.Span.End.Offset-l.base]; raw != tok.Lexeme {
+		tok.Raw = raw
+	}
+	return tok
+}
+
+// readTrivia collects whitespace and comments up to the next line break or
+// significant token
+func (l *Lexer) readTrivia() []token.Trivia {
+	first := len(l.trivia)
+	for l.pos < len(l.input) {
+		start := l.pos
+		ch := l.peek(0)
+		switch {
+		case ch == '<' && l.peek(1) == '!':
+			l.readMultiComment()
+			l.trivia = append(l.trivia, token.Trivia{Type: token.COMMENT_MULTI, Text: l.input[start:l.pos]})
+		case ch == '!' && l.peek(1) == '>' && l.peek(2) != '>':
+			l.readLineComment("!>")
+			l.trivia = append(l.trivia, token.Trivia{Type: token.COMMENT_LINE, Text: l.input[start:l.pos]})
+		case ch != '\n' && unicode.IsSpace(l.peekRune()):
+			l.skipWhitespace()
+			l.trivia = append(l.trivia, token.Trivia{Type: token.WHITESPACE, Text: l.input[start:l.pos]})
+		default:
+			return l.triviaSince(first)
 		}
+	}
+	return l.triviaSince(first)
+}
 
-		// Handle operators and delimiters
-		switch ch {
-		case ';':
-			l.advance()
-			l.addToken(token.STATEMENT_END, ";", line, column)
+// triviaSince returns the trivia read since l.trivia had n entries. The
+// slice is capped so appending to it can't overwrite a later token's trivia.
+func (l *Lexer) triviaSince(n int) []token.Trivia {
+	if len(l.trivia) == n {
+		return nil
+	}
+	return l.trivia[n:len(l.trivia):len(l.trivia)]
+}
 
-		case '+':
-			l.advance()
-			if l.peek(0) == '+' {
-				l.advance()
-				l.addToken(token.INCREMENT, "++", line, column)
-			} else if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.PLUS_ASSIGN, "+=", line, column)
-			} else {
-				l.addToken(token.PLUS, "+", line, column)
-			}
+// scan lexes the next token, skipping any whitespace before it
+func (l *Lexer) scan() token.Token {
+	l.value, l.parts = "", nil
+	tokenType, lexeme := l.lex()
+	tok := l.makeToken(tokenType, lexeme, l.start)
+	tok.Value, tok.Parts = l.value, l.parts
+	return tok
+}
 
-		case '-':
-			l.advance()
-			if l.peek(0) == '-' {
-				l.advance()
-				l.addToken(token.DECREMENT, "--", line, column)
-			} else if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.MINUS_ASSIGN, "-=", line, column)
-			} else if l.peek(0) == '>' {
-				l.advance()
-				l.addToken(token.ARROW, "->", line, column)
-			} else {
-				l.addToken(token.MINUS, "-", line, column)
-			}
+// lex lexes the next token, skipping any whitespace before it, and returns
+// its type and lexeme. The token covers the input from l.start to the
+// current position.
+func (l *Lexer) lex() (token.TokenType, string) {
+	tokenType, lexeme := l.lexToken()
+	l.stmt.next(tokenType)
+	return tokenType, lexeme
+}
 
-		case '*':
-			l.advance()
-			if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.MULT_ASSIGN, "*=", line, column)
-			} else {
-				l.addToken(token.MULTIPLY, "*", line, column)
-			}
+// lexToken is lex without the statement tracking
+func (l *Lexer) lexToken() (token.TokenType, string) {
+	l.skipWhitespace()
+	l.start = l.mark()
+	if l.pos >= len(l.input) {
+		return token.EOF, ""
+	}
 
-		case '/':
-			l.advance()
-			if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.DIV_ASSIGN, "/=", line, column)
-			} else {
-				l.addToken(token.DIVIDE, "/", line, column)
-			}
+	start := l.start
+	ch := l.peek(0)
 
-		case '%':
-			l.advance()
-			if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.MOD_ASSIGN, "%=", line, column)
-			} else {
-				l.addToken(token.MODULO, "%", line, column)
-			}
+	if l.base+l.pos == l.pragmaAt {
+		return l.readPragma(start)
+	}
 
-		case '=':
-			l.advance()
-			if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.EQ, "==", line, column)
-			} else if l.peek(0) == ':' {
-				l.advance()
-				l.addToken(token.ASSIGN, "=:", line, column)
-			} else if l.peek(0) == '>' {
-				l.advance()
-				l.addToken(token.FAT_ARROW, "=>", line, column)
-			} else {
-				l.addToken(token.ILLEGAL, "=", line, column)
-			}
+	// Handle Synta comments first (must be checked before < and ! operators)
+	if ch == '<' && l.peek(1) == '!' {
+		text := l.readMultiComment()
+		return token.COMMENT_MULTI, text
+	}
 
-		case ':':
-			l.advance()
-			if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.BIND_ASSIGN, ":=", line, column)
-			} else {
-				l.addToken(token.COLON, ":", line, column)
-			}
+	if ch == '!' && l.peek(1) == '>' && l.peek(2) == '>' {
+		text := l.readLineComment("!>>")
+		return token.DOC_COMMENT, text
+	}
 
-		case '!':
-			l.advance()
-			if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.NEQ, "!=", line, column)
-			} else {
-				l.addToken(token.NOT, "!", line, column)
-			}
+	if ch == '!' && l.peek(1) == '>' {
+		text := l.readLineComment("!>")
+		return token.COMMENT_LINE, text
+	}
 
-		case '<':
-			l.advance()
-			if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.LTE, "<=", line, column)
-			} else {
-				l.addToken(token.LT, "<", line, column)
-			}
+	// Handle shell directives at the start of a statement: !pip install unsloth
+	if ch == '!' && l.peek(1) != '=' && !unicode.IsSpace(rune(l.peek(1))) && l.peek(1) != 0 &&
+		l.stmt.atStart() && l.atLineStart() {
+		return l.readDirective()
+	}
 
-		case '>':
-			l.advance()
-			if l.peek(0) == '=' {
-				l.advance()
-				l.addToken(token.GTE, ">=", line, column)
-			} else {
-				l.addToken(token.GT, ">", line, column)
+	// Handle @ decorators
+	if ch == '@' {
+		l.advance()
+		if isLetter(l.peekRune()) {
+			ident := l.readIdentifier()
+			switch ident {
+			case "agent":
+				return token.AT_AGENT, "@agent"
+			case "task":
+				return token.AT_TASK, "@task"
+			case "step":
+				return token.AT_STEP, "@step"
+			case "intent":
+				return token.AT_INTENT, "@intent"
+			case "explain":
+				return token.AT_EXPLAIN, "@explain"
+			default:
+				return token.DECORATOR, l.input[start.offset-l.base : l.pos]
 			}
+		} else {
+			l.report(ErrMissingDecorator, start, "expected decorator name after '@'",
+				"decorators look like `@agent` or `@task`")
+			return token.ILLEGAL, "@"
+		}
+	}
 
-		case '&':
-			l.advance()
-			if l.peek(0) == '&' {
-				l.advance()
-				l.addToken(token.AND, "&&", line, column)
-			} else {
-				l.addToken(token.AMPERSAND, "&", line, column)
-			}
+	// Handle raw strings: raw"..." and raw"""..."""
+	if ch == 'r' && strings.HasPrefix(l.input[l.pos:], "raw") && (l.peek(3) == '"' || l.peek(3) == '\'') {
+		l.advance() // r
+		l.advance() // a
+		l.advance() // w
+		return l.readStringToken(start, true)
+	}
 
-		case '|':
-			l.advance()
-			if l.peek(0) == '|' {
-				l.advance()
-				l.addToken(token.OR, "||", line, column)
-			} else {
-				l.addToken(token.PIPE_OP, "|", line, column)
-			}
+	// Handle identifiers and keywords
+	if isLetter(l.peekRune()) {
+		ident := l.readIdentifier()
+		tokenType, lexeme := token.Keyword(ident, l.edition)
+		return tokenType, lexeme
+	}
+
+	// Handle numbers
+	if isDigit(rune(ch)) {
+		num, tokenType := l.readNumber()
+		return tokenType, num
+	}
+
+	// Handle strings
+	if ch == '"' || ch == '\'' {
+		return l.readStringToken(start, false)
+	}
+
+	// Handle operators and delimiters
+	switch ch {
+	case ';':
+		l.advance()
+		return token.STATEMENT_END, ";"
 
-		case '^':
+	case '+':
+		l.advance()
+		if l.peek(0) == '+' {
+			l.advance()
+			return token.INCREMENT, "++"
+		} else if l.peek(0) == '=' {
 			l.advance()
-			l.addToken(token.BITWISE_XOR, "^", line, column)
+			return token.PLUS_ASSIGN, "+="
+		} else {
+			return token.PLUS, "+"
+		}
 
-		case '(':
+	case '-':
+		l.advance()
+		if l.peek(0) == '-' {
+			l.advance()
+			return token.DECREMENT, "--"
+		} else if l.peek(0) == '=' {
 			l.advance()
-			l.addToken(token.LPAREN, "(", line, column)
+			return token.MINUS_ASSIGN, "-="
+		} else if l.peek(0) == '>' {
+			l.advance()
+			return token.ARROW, "->"
+		} else {
+			return token.MINUS, "-"
+		}
 
-		case ')':
+	case '*':
+		l.advance()
+		if l.peek(0) == '=' {
 			l.advance()
-			l.addToken(token.RPAREN, ")", line, column)
+			return token.MULT_ASSIGN, "*="
+		} else {
+			return token.MULTIPLY, "*"
+		}
 
-		case '[':
+	case '/':
+		l.advance()
+		if l.peek(0) == '=' {
 			l.advance()
-			l.addToken(token.LBRACKET, "[", line, column)
+			return token.DIV_ASSIGN, "/="
+		} else {
+			return token.DIVIDE, "/"
+		}
 
-		case ']':
+	case '%':
+		l.advance()
+		if l.peek(0) == '=' {
 			l.advance()
-			l.addToken(token.RBRACKET, "]", line, column)
+			return token.MOD_ASSIGN, "%="
+		} else {
+			return token.MODULO, "%"
+		}
 
-		case '{':
+	case '=':
+		l.advance()
+		if l.peek(0) == '=' {
+			l.advance()
+			return token.EQ, "=="
+		} else if l.peek(0) == ':' {
+			l.advance()
+			return token.ASSIGN, "=:"
+		} else if l.peek(0) == '>' {
 			l.advance()
-			l.addToken(token.LBRACE, "{", line, column)
+			return token.FAT_ARROW, "=>"
+		} else {
+			l.report(ErrIllegalCharacter, start, "unexpected '='",
+				"did you mean `=:` or `:=`?")
+			return token.ILLEGAL, "="
+		}
 
-		case '}':
+	case ':':
+		l.advance()
+		if l.peek(0) == '=' {
 			l.advance()
-			l.addToken(token.RBRACE, "}", line, column)
+			return token.BIND_ASSIGN, ":="
+		} else {
+			return token.COLON, ":"
+		}
 
-		case ',':
+	case '!':
+		l.advance()
+		if l.peek(0) == '=' {
 			l.advance()
-			l.addToken(token.COMMA, ",", line, column)
+			return token.NEQ, "!="
+		} else {
+			return token.NOT, "!"
+		}
 
-		case '.':
+	case '<':
+		l.advance()
+		if l.peek(0) == '=' {
 			l.advance()
-			// Check if this is a function like .config
-			if unicode.IsLetter(rune(l.peek(0))) || l.peek(0) == '_' {
-				ident := l.readIdentifier()
-				l.addToken(token.IDENTIFIER, "."+ident, line, column)
-			} else {
-				l.addToken(token.DOT, ".", line, column)
-			}
+			return token.LTE, "<="
+		} else {
+			return token.LT, "<"
+		}
 
-		case '\n':
+	case '>':
+		l.advance()
+		if l.peek(0) == '=' {
 			l.advance()
-			l.addToken(token.NEWLINE, "\\n", line, column)
+			return token.GTE, ">="
+		} else {
+			return token.GT, ">"
+		}
 
-		case '$':
+	case '&':
+		l.advance()
+		if l.peek(0) == '&' {
 			l.advance()
-			l.addToken(token.DOLLAR, "$", line, column)
+			return token.AND, "&&"
+		} else {
+			return token.AMPERSAND, "&"
+		}
 
-		default:
+	case '|':
+		l.advance()
+		if l.peek(0) == '|' {
 			l.advance()
-			l.addToken(token.ILLEGAL, string(ch), line, column)
+			return token.OR, "||"
+		} else {
+			return token.PIPE_OP, "|"
 		}
-	}
 
-	l.addToken(token.EOF, "", l.line, l.column)
-	return l.tokens
+	case '^':
+		l.advance()
+		return token.BITWISE_XOR, "^"
+
+	case '(':
+		l.advance()
+		return token.LPAREN, "("
+
+	case ')':
+		l.advance()
+		return token.RPAREN, ")"
+
+	case '[':
+		l.advance()
+		return token.LBRACKET, "["
+
+	case ']':
+		l.advance()
+		return token.RBRACKET, "]"
+
+	case '{':
+		l.advance()
+		return token.LBRACE, "{"
+
+	case '}':
+		l.advance()
+		return token.RBRACE, "}"
+
+	case ',':
+		l.advance()
+		return token.COMMA, ","
+
+	case '.':
+		// .rows is DOT followed by IDENTIFIER; the parser builds the member
+		// expression
+		l.advance()
+		return token.DOT, "."
+
+	case '\n':
+		l.advance()
+		return token.NEWLINE, "\\n"
+
+	case '$':
+		l.advance()
+		return token.DOLLAR, "$"
+
+	default:
+		r := l.advance()
+		l.report(ErrIllegalCharacter, start, fmt.Sprintf("illegal character %q", r), "")
+		return token.ILLEGAL, string(r)
+	}
 }
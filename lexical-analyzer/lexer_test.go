@@ -0,0 +1,558 @@
+package lexer
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"synta-compiler/token"
+	"testing"
+	"time"
+)
+
+// TestTriviaRoundTrip checks that lossless mode reproduces every example
+// file byte for byte
+func TestTriviaRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.synta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no example files found")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens := New(string(src), WithTrivia()).Tokenize()
+			if got := token.Source(tokens); got != string(src) {
+				t.Errorf("round trip mismatch: got %d bytes, want %d", len(got), len(src))
+			}
+		})
+	}
+}
+
+// TestRelexMatchesFullLex applies edits to the examples and checks that
+// incremental re-lexing gives the same tokens and diagnostics as lexing the
+// edited source from scratch
+func TestRelexMatchesFullLex(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.synta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inserts := []string{"", "x", " ", "\n", "\"", "'''", "<!", "!>", "!", "=", ":", "1e", "ms", "${", "}", "raw", "é", "@agent ", "edition 2026\n", "!pip x;", "\\\n", "(", "&&\n"}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, opts := range [][]Option{nil, {WithTrivia()}} {
+			rng := rand.New(rand.NewSource(int64(len(src))))
+			for i := 0; i < 200; i++ {
+				offset := rng.Intn(len(src) + 1)
+				if i%20 == 0 {
+					offset = 0 // where an edition pragma takes effect
+				}
+				edit := Edit{
+					Offset:   offset,
+					Deleted:  rng.Intn(min(8, len(src)-offset) + 1),
+					Inserted: inserts[rng.Intn(len(inserts))],
+				}
+				checkRelex(t, filepath.Base(file), string(src), edit, opts)
+			}
+		}
+	}
+
+	// A directive gives back the ';' and blanks after it, so it depends on
+	// the rest of its line
+	for _, opts := range [][]Option{nil, {WithTrivia()}} {
+		checkRelex(t, "directive", "a;\n!pip x ;      \nb\n", Edit{Offset: 16, Inserted: "y"}, opts)
+		checkRelex(t, "directive", "!pip x ;          \nb\n", Edit{Offset: 17, Deleted: 1}, opts)
+	}
+}
+
+// checkRelex applies edit to src and checks that Relex gives the same
+// tokens and diagnostics as a full lex of the result
+func checkRelex(t *testing.T, name, src string, edit Edit, opts []Option) {
+	t.Helper()
+	old := New(src, opts...)
+	prev := old.Tokenize()
+	edited := edit.Apply(src)
+
+	full := New(edited, opts...)
+	want := full.Tokenize()
+	inc := New(edited, opts...)
+	got := inc.Relex(prev, old.Errors(), edit)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: tokens differ from a full lex after %+v", name, edit)
+	}
+	if !reflect.DeepEqual(inc.Errors(), full.Errors()) {
+		t.Fatalf("%s: diagnostics differ from a full lex after %+v", name, edit)
+	}
+}
+
+func TestIndentation(t *testing.T) {
+	src := "with a as f:\n    x\n\n    if y {\n  z\n    }\n    with b:\n        w\nv\n"
+	want := []token.TokenType{
+		token.WITH, token.IDENTIFIER, token.AS, token.IDENTIFIER, token.COLON, token.NEWLINE,
+		token.INDENT, token.IDENTIFIER, token.NEWLINE, token.NEWLINE,
+		token.IF, token.IDENTIFIER, token.LBRACE, token.NEWLINE,
+		token.IDENTIFIER, token.NEWLINE, // inside braces, so no DEDENT
+		token.RBRACE, token.NEWLINE,
+		token.WITH, token.IDENTIFIER, token.COLON, token.NEWLINE,
+		token.INDENT, token.IDENTIFIER, token.NEWLINE,
+		token.DEDENT, token.DEDENT, token.IDENTIFIER, token.NEWLINE,
+		token.EOF,
+	}
+
+	l := New(src, WithIndentation())
+	var got []token.TokenType
+	for _, tok := range l.Tokenize() {
+		got = append(got, tok.Type)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("token types:\n got %v\nwant %v", got, want)
+	}
+}
+
+// TestIndentationErrors checks that a line closing blocks must line up with
+// an outer level, the top level included
+func TestIndentationErrors(t *testing.T) {
+	tests := map[string]int{
+		"with a:\n    x\ny\n":                        0,
+		"with a:\n    with b:\n        x\n    y\n":   0,
+		"with a:\n    x\n  y\n":                      1,
+		"with a:\n    with b:\n        x\n      y\n": 1,
+		"with a:\ny\n":                               1,
+	}
+	for src, want := range tests {
+		l := New(src, WithIndentation())
+		l.Tokenize()
+		if got := codes(l.Errors()); len(got) != want || want > 0 && got[0] != ErrIndentation {
+			t.Errorf("%q: diagnostics %v, want %d %s", src, l.Errors(), want, ErrIndentation)
+		}
+	}
+}
+
+func TestInterpolationDepth(t *testing.T) {
+	for depth, want := range map[int][]string{maxInterpolationDepth: nil, maxInterpolationDepth + 1: {ErrInterpolationDepth}} {
+		src := strings.Repeat(`"${`, depth) + "x" + strings.Repeat(`}"`, depth)
+		l := New(src)
+		l.Tokenize()
+		if got := codes(l.Errors()); !reflect.DeepEqual(got, want) {
+			t.Errorf("depth %d: got %v, want %v", depth, l.Errors(), want)
+		}
+	}
+}
+
+// TestMemberAccess checks that a dot before a name is its own token
+func TestMemberAccess(t *testing.T) {
+	want := []token.TokenType{
+		token.IDENTIFIER, token.DOT, token.IDENTIFIER, token.LBRACKET, token.INTEGER, token.RBRACKET,
+		token.DOT, token.IDENTIFIER, token.PLUS, token.FLOAT, token.EOF,
+	}
+	var got []token.TokenType
+	for _, tok := range New("data.rows[0].id + 1.5").Tokenize() {
+		got = append(got, tok.Type)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("token types:\n got %v\nwant %v", got, want)
+	}
+}
+
+// TestDirectives checks that a '!' only starts a shell directive at the
+// start of a statement, not on the continuation line of an expression
+func TestDirectives(t *testing.T) {
+	tests := map[string]int{
+		"!pip install unsloth\n":          1,
+		"x := 1\n  !pip install x;\n":     1,
+		"fn f() {\n!ls\n}\n":              1,
+		"i++\n!ls\n":                      1,
+		"if (ready &&\n!done) { go() }\n": 0,
+		"x := ready &&\n!done\n":          0,
+		"f(a,\n!b)\n":                     0,
+		"xs := [a,\n!b]\n":                0,
+		"f(\n)\n!ls\n":                    1,
+	}
+	for src, want := range tests {
+		got := 0
+		for _, tok := range New(src).Tokenize() {
+			if tok.Type == token.SHELL_DIRECTIVE {
+				got++
+			}
+		}
+		if got != want {
+			t.Errorf("%q: got %d directives, want %d", src, got, want)
+		}
+	}
+}
+
+// TestScanMatchesTokenize checks that the compact scanner finds the same
+// tokens and diagnostics as Tokenize, with and without trivia and
+// indentation
+func TestScanMatchesTokenize(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.synta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{
+		"nested":   "x := \"${f(\"${a = b}\", '${\\q}')} ${c\" d",
+		"too deep": strings.Repeat(`"${`, maxInterpolationDepth+1) + "x" + strings.Repeat(`}"`, maxInterpolationDepth+1),
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources[filepath.Base(file)] = string(src)
+	}
+	for name, src := range sources {
+		for _, opts := range [][]Option{nil, {WithTrivia()}, {WithIndentation()}} {
+			full := New(src, opts...)
+			var want []token.Offsets
+			for _, tok := range full.Tokenize() {
+				want = append(want, token.Offsets{Type: tok.Type, Start: int32(tok.Span.Start.Offset), End: int32(tok.Span.End.Offset)})
+			}
+			compact := New(src, opts...)
+			if got := compact.Scan(nil); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: Scan and Tokenize disagree", name)
+			}
+			if !reflect.DeepEqual(compact.Errors(), full.Errors()) {
+				t.Errorf("%s: Scan and Tokenize report different diagnostics", name)
+			}
+		}
+	}
+}
+
+// codes returns the codes of diags
+func codes(diags []Diagnostic) []string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, d.Code)
+	}
+	return out
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		src   string
+		value string
+		codes []string
+	}{
+		{`"a\tb\n"`, "a\tb\n", nil},
+		{`'it\'s'`, "it's", nil},
+		{`"\\ \" \$"`, `\ " $`, nil},
+		{`"\u{1F916}"`, "🤖", nil},
+		{`"\u{e9}t\u{E9}"`, "été", nil},
+		{"\"a\\\nb\"", "ab", nil},
+		{`"\q"`, `\q`, []string{ErrInvalidEscape}},
+		{`"\u1F"`, "1F", []string{ErrInvalidEscape}},
+		{`"\u{}"`, "}", []string{ErrInvalidEscape}},
+		{`"\u{1234567}"`, "}", []string{ErrInvalidEscape}},
+		{`"\u{110000}"`, "", []string{ErrInvalidEscape}},
+		{`"\u{D800}"`, "", []string{ErrInvalidEscape}},
+		{`"\`, "", []string{ErrInvalidEscape, ErrUnterminatedString}},
+	}
+	for _, tt := range tests {
+		l := New(tt.src)
+		tok := l.NextToken()
+		if tok.Type != token.STRING || tok.Value != tt.value {
+			t.Errorf("%s: got %v %q, want STRING %q", tt.src, tok.Type, tok.Value, tt.value)
+		}
+		l.Tokenize()
+		if got := codes(l.Errors()); !reflect.DeepEqual(got, tt.codes) {
+			t.Errorf("%s: diagnostics %v, want %v", tt.src, got, tt.codes)
+		}
+	}
+}
+
+// TestRawAndMultilineStrings checks the values of raw and triple-quoted
+// strings, and that lines and columns are right after a string spanning lines
+func TestRawAndMultilineStrings(t *testing.T) {
+	tests := []struct {
+		src          string
+		value        string
+		line, col    int // of the identifier after the string
+		unterminated bool
+	}{
+		{`raw"C:\new\${x}" y`, `C:\new\${x}`, 1, 18, false},
+		{`raw'\d+' y`, `\d+`, 1, 10, false},
+		{"\"\"\"a\n  \"b\"\n\"\"\" y", "a\n  \"b\"\n", 3, 5, false},
+		{"'''\\tx\n''' y", "\tx\n", 2, 5, false},
+		{"raw\"\"\"\\n\n\"\"\" y", "\\n\n", 2, 5, false},
+		{"\"a\ny", "a", 2, 1, true},
+		{"\"\"\"a\ny", "a\ny", 0, 0, true},
+	}
+	for _, tt := range tests {
+		l := New(tt.src)
+		tokens := l.Tokenize()
+		if tokens[0].Type != token.STRING || tokens[0].Value != tt.value {
+			t.Errorf("%q: got %v %q, want STRING %q", tt.src, tokens[0].Type, tokens[0].Value, tt.value)
+		}
+		if tt.line > 0 {
+			var ident token.Token
+			for _, tok := range tokens {
+				if tok.Type == token.IDENTIFIER {
+					ident = tok
+				}
+			}
+			if ident.Line != tt.line || ident.Column != tt.col {
+				t.Errorf("%q: identifier at %d:%d, want %d:%d", tt.src, ident.Line, ident.Column, tt.line, tt.col)
+			}
+		}
+		if got := len(l.Errors()) > 0 && l.Errors()[0].Code == ErrUnterminatedString; got != tt.unterminated {
+			t.Errorf("%q: diagnostics %v", tt.src, l.Errors())
+		}
+	}
+}
+
+func TestDurations(t *testing.T) {
+	tests := map[string]time.Duration{
+		"500ms":   500 * time.Millisecond,
+		"120s":    2 * time.Minute,
+		"10m":     10 * time.Minute,
+		"1.5h":    90 * time.Minute,
+		"2d":      48 * time.Hour,
+		"1_000ms": time.Second,
+		"1e3ms":   time.Second,
+		"2.3h":    2*time.Hour + 18*time.Minute,
+		"1.005s":  1005 * time.Millisecond,
+		"0.1ms":   100 * time.Microsecond,
+	}
+	for src, want := range tests {
+		tokens := New(src).Tokenize()
+		if len(tokens) != 2 || tokens[0].Type != token.DURATION || tokens[0].Lexeme != src {
+			t.Errorf("%s: got %v", src, tokens)
+			continue
+		}
+		if got, err := token.ParseDuration(tokens[0].Lexeme); err != nil || got != want {
+			t.Errorf("%s: got %v, %v, want %v", src, got, err, want)
+		}
+	}
+
+	// A unit followed by more of a word is not a unit
+	for _, src := range []string{"5min", "3sec", "2days", "1h2"} {
+		if tokens := New(src).Tokenize(); tokens[0].Type == token.DURATION {
+			t.Errorf("%s: lexed as a duration: %v", src, tokens)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		src string
+		typ token.TokenType
+		bad string // message of the expected diagnostic, if any
+	}{
+		{"42", token.INTEGER, ""},
+		{"1_000_000", token.INTEGER, ""},
+		{"0x1F", token.INTEGER, ""},
+		{"0Xdead_BEEF", token.INTEGER, ""},
+		{"0b1010", token.INTEGER, ""},
+		{"0o755", token.INTEGER, ""},
+		{"3.14", token.FLOAT, ""},
+		{"2e-4", token.FLOAT, ""},
+		{"1.5E+3", token.FLOAT, ""},
+		{"6e23", token.FLOAT, ""},
+		{"1_0.0_1", token.FLOAT, ""},
+		{"1__0", token.INTEGER, "misplaced digit separator '_'"},
+		{"10_", token.INTEGER, "misplaced digit separator '_'"},
+		{"0x", token.INTEGER, "hexadecimal literal has no digits"},
+		{"0b", token.INTEGER, "binary literal has no digits"},
+		{"0b102", token.INTEGER, `invalid digit '2' in binary literal`},
+		{"0o78", token.INTEGER, `invalid digit '8' in octal literal`},
+		{"0x1G", token.INTEGER, `invalid digit 'G' in hexadecimal literal`},
+	}
+	for _, tt := range tests {
+		l := New(tt.src)
+		tokens := l.Tokenize()
+		if len(tokens) != 2 || tokens[0].Type != tt.typ || tokens[0].Lexeme != tt.src {
+			t.Errorf("%s: got %v, want one %v", tt.src, tokens, tt.typ)
+		}
+		var got string
+		if len(l.Errors()) > 0 {
+			got = l.Errors()[0].Message
+			if d := l.Errors()[0]; d.Code != ErrMalformedNumber || d.Start.Offset != 0 {
+				t.Errorf("%s: got %+v, want %s from offset 0", tt.src, d, ErrMalformedNumber)
+			}
+		}
+		if got != tt.bad {
+			t.Errorf("%s: diagnostic %q, want %q", tt.src, got, tt.bad)
+		}
+	}
+
+	// An exponent needs digits, so 1e is a number followed by a name
+	var got []token.TokenType
+	for _, tok := range New("1e x.5").Tokenize() {
+		got = append(got, tok.Type)
+	}
+	want := []token.TokenType{token.INTEGER, token.IDENTIFIER, token.IDENTIFIER, token.DOT, token.INTEGER, token.EOF}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("token types:\n got %v\nwant %v", got, want)
+	}
+}
+
+// TestEditions checks that the edition pragma, or WithEdition when there is
+// none, picks the keyword set, and that 2025 keeps the newer words as names
+func TestEditions(t *testing.T) {
+	const src = "import x\nswitch in true null\n"
+	ident := token.IDENTIFIER
+	keywords2025 := []token.TokenType{ident, ident, ident, ident, ident, ident}
+	keywords2026 := []token.TokenType{token.IMPORT, ident, token.SWITCH, token.IN, token.TRUE, token.NULL}
+	tests := []struct {
+		src  string
+		opts []Option
+		want []token.TokenType
+	}{
+		{src, nil, keywords2025},
+		{"edition 2025\n" + src, nil, keywords2025},
+		{"edition 2026\n" + src, nil, keywords2026},
+		{src, []Option{WithEdition(token.Edition2026)}, keywords2026},
+		{"edition 2025\n" + src, []Option{WithEdition(token.Edition2026)}, keywords2025},
+		{"<! header !>\n!> comment\nedition 2026\n" + src, nil, keywords2026},
+		{"edition 2099\n" + src, nil, keywords2025},
+	}
+	for _, tt := range tests {
+		var got []token.TokenType
+		for _, tok := range New(tt.src, tt.opts...).Tokenize() {
+			switch tok.Type {
+			case token.EDITION, token.NEWLINE, token.COMMENT_LINE, token.COMMENT_MULTI, token.EOF:
+			default:
+				got = append(got, tok.Type)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: token types:\n got %v\nwant %v", tt.src, got, tt.want)
+		}
+	}
+
+	// Only comments may come before the pragma
+	var got []token.TokenType
+	for _, tok := range New("x\nedition 2026\nin").Tokenize() {
+		got = append(got, tok.Type)
+	}
+	want := []token.TokenType{ident, token.NEWLINE, ident, token.INTEGER, token.NEWLINE, ident, token.EOF}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("late pragma: token types:\n got %v\nwant %v", got, want)
+	}
+
+	l := New("edition 2099\n")
+	l.Tokenize()
+	if got := codes(l.Errors()); !reflect.DeepEqual(got, []string{ErrUnknownEdition}) {
+		t.Errorf("edition 2099: diagnostics %v", l.Errors())
+	}
+}
+
+// TestDiagnostics checks the code, span and hint of the first diagnostic
+// for each kind of lexical error
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		src        string
+		code       string
+		start, end int // byte offsets
+		column     int
+		hint       string
+	}{
+		{`"abc`, ErrUnterminatedString, 0, 4, 1, `add a closing " before the end of the line, or use """ for multiline strings`},
+		{"x := 'a\nb", ErrUnterminatedString, 5, 7, 6, "add a closing ' before the end of the line, or use ''' for multiline strings"},
+		{"<! open", ErrUnterminatedComment, 0, 7, 1, "close the comment with `!>`"},
+		{"x = 1", ErrIllegalCharacter, 2, 3, 3, "did you mean `=:` or `:=`?"},
+		{"@ x", ErrMissingDecorator, 0, 1, 1, "decorators look like `@agent` or `@task`"},
+		{"a # b", ErrIllegalCharacter, 2, 3, 3, ""},
+		{"é§", ErrIllegalCharacter, 2, 4, 2, ""},
+		{`"${a`, ErrUnterminatedInterp, 1, 4, 2, "close the expression with `}`"},
+	}
+	for _, tt := range tests {
+		l := New(tt.src)
+		l.Tokenize()
+		if len(l.Errors()) == 0 {
+			t.Errorf("%q: no diagnostics", tt.src)
+			continue
+		}
+		d := l.Errors()[0]
+		if d.Code != tt.code || d.Start.Offset != tt.start || d.End.Offset != tt.end || d.Start.Column != tt.column || d.Hint != tt.hint {
+			t.Errorf("%q: got %s [%d, %d) column %d hint %q\nwant %s [%d, %d) column %d hint %q", tt.src,
+				d.Code, d.Start.Offset, d.End.Offset, d.Start.Column, d.Hint,
+				tt.code, tt.start, tt.end, tt.column, tt.hint)
+		}
+	}
+}
+
+// TestColumns checks rune and UTF-16 columns after the emoji on line 225 of
+// the dual-agent example, `    print("🤖 Agent 1 (DataProcessor): ...");`,
+// where 🤖 is one rune but two UTF-16 code units
+func TestColumns(t *testing.T) {
+	src, err := os.ReadFile("../examples/1-dual-agents.synta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineStart := len(strings.Join(strings.SplitAfter(string(src), "\n")[:224], ""))
+
+	type columns struct{ column, utf16, offset int }
+	want := []columns{
+		{5, 5, 4},    // print
+		{10, 10, 9},  // (
+		{11, 11, 10}, // the string
+		{66, 67, 68}, // )
+		{67, 68, 69}, // ;
+	}
+	var got []columns
+	for _, tok := range New(string(src)).Tokenize() {
+		if tok.Line == 225 && tok.Type != token.NEWLINE {
+			got = append(got, columns{tok.Column, tok.UTF16Column, tok.Span.Start.Offset - lineStart})
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("line 225:\n got %v\nwant %v", got, want)
+	}
+}
+
+// TestInterpolationPositions checks that the tokens lexed from a ${...}
+// expression are placed where they are in the source, after an emoji on
+// line 386 of the dual-agent example and inside a nested interpolation
+func TestInterpolationPositions(t *testing.T) {
+	src, err := os.ReadFile("../examples/1-dual-agents.synta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineStart := len(strings.Join(strings.SplitAfter(string(src), "\n")[:385], ""))
+
+	type place struct {
+		lexeme              string
+		line, column, utf16 int
+		offset              int
+	}
+	var got []place
+	for _, tok := range New(string(src)).Tokenize() {
+		if tok.Line == 386 && tok.Type == token.STRING {
+			for _, part := range tok.Parts {
+				for _, inner := range part.Tokens {
+					got = append(got, place{inner.Lexeme, inner.Line, inner.Column, inner.UTF16Column, inner.Span.Start.Offset - lineStart})
+				}
+			}
+		}
+	}
+	want := []place{
+		{"results", 386, 36, 37, 38},
+		{".", 386, 43, 44, 45},
+		{"agent_two", 386, 44, 45, 46},
+		{".", 386, 53, 54, 55},
+		{"code", 386, 54, 55, 56},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("line 386:\n got %v\nwant %v", got, want)
+	}
+
+	tokens := New("x := 1\ns := \"${f(\"${b}\")}\"").Tokenize()
+	outer := tokens[6].Parts[0].Tokens
+	b := outer[2].Parts[0].Tokens[0]
+	if b.Lexeme != "b" || b.Line != 2 || b.Column != 14 || b.Span.Start.Offset != 20 {
+		t.Errorf("nested: got %q at %d:%d offset %d, want \"b\" at 2:14 offset 20", b.Lexeme, b.Line, b.Column, b.Span.Start.Offset)
+	}
+}
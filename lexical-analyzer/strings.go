@@ -0,0 +1,259 @@
+// lexer/strings.go
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"synta-compiler/token"
+	"unicode/utf8"
+)
+
+// readStringToken lexes a string literal whose first token character (the
+// quote, or the raw prefix already consumed) started at start
+func (l *Lexer) readStringToken(start position, raw bool) (token.TokenType, string) {
+	lexeme, value, parts := l.readString(start, raw)
+	l.value, l.parts = value, parts
+	return token.STRING, lexeme
+}
+
+// readString reads a quoted string: "..." and '...' end at the line break,
+// while strings delimited by three quotes ("""...""") may span lines. Escapes are decoded
+// into the returned value unless raw is set. If the string contains ${...}
+// interpolations it is also returned split into parts, with each expression
+// lexed into its own token run.
+func (l *Lexer) readString(start position, raw bool) (string, string, []token.StringPart) {
+	quote := l.input[l.pos]
+	delim := l.input[l.pos : l.pos+1]
+	if l.peek(1) == quote && l.peek(2) == quote {
+		delim = l.input[l.pos : l.pos+3]
+	}
+	multiline := len(delim) == 3
+	for range delim {
+		l.advance() // consume opening quote(s)
+	}
+
+	// Plain text is copied into text a run at a time, only once an escape or
+	// interpolation means the value can't simply be a slice of the input
+	begin := l.pos
+	run := l.pos
+	decoded := false
+	var value, text strings.Builder
+	var parts []token.StringPart
+
+	for l.pos < len(l.input) && !strings.HasPrefix(l.input[l.pos:], delim) {
+		ch := l.input[l.pos]
+		if ch == '\n' && !multiline {
+			break
+		}
+
+		if l.compact && !raw && (ch == '\\' || ch == '$' && l.peek(1) == '{') {
+			// Scan only needs the string's extent and diagnostics
+			if ch == '\\' {
+				l.readEscape(nil)
+			} else {
+				l.readInterpolation()
+			}
+		} else if ch == '\\' && !raw {
+			text.WriteString(l.input[run:l.pos])
+			l.readEscape(&text)
+			run, decoded = l.pos, true
+		} else if ch == '$' && l.peek(1) == '{' && !raw {
+			text.WriteString(l.input[run:l.pos])
+			if text.Len() > 0 {
+				parts = append(parts, token.StringPart{Text: text.String()})
+				value.WriteString(text.String())
+				text.Reset()
+			}
+			exprStart := l.pos
+			parts = append(parts, l.readInterpolation())
+			value.WriteString(l.input[exprStart:l.pos])
+			run, decoded = l.pos, true
+		} else {
+			l.advance()
+		}
+	}
+
+	str := l.input[begin:l.pos]
+	val := str
+	if decoded {
+		text.WriteString(l.input[run:l.pos])
+		value.WriteString(text.String())
+		if parts != nil && text.Len() > 0 {
+			parts = append(parts, token.StringPart{Text: text.String()})
+		}
+		val = value.String()
+	}
+
+	if strings.HasPrefix(l.input[l.pos:], delim) {
+		for range delim {
+			l.advance() // consume closing quote(s)
+		}
+	} else if multiline {
+		l.report(ErrUnterminatedString, start, "unterminated multiline string",
+			fmt.Sprintf("close the string with %s", delim))
+	} else {
+		l.report(ErrUnterminatedString, start, "unterminated string literal",
+			fmt.Sprintf("add a closing %s before the end of the line, or use %s%s%s for multiline strings", delim, delim, delim, delim))
+	}
+	return str, val, parts
+}
+
+// readEscape decodes the escape sequence at the current position into out.
+// With a nil out the escape is only checked.
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start := l.mark()
+	l.advance() // backslash
+	if l.pos >= len(l.input) {
+		l.report(ErrInvalidEscape, start, "incomplete escape sequence", "")
+		return
+	}
+
+	decoded := rune(-1)
+	r := l.advance()
+	switch r {
+	case 'n':
+		decoded = '\n'
+	case 't':
+		decoded = '\t'
+	case 'r':
+		decoded = '\r'
+	case '0':
+		decoded = 0
+	case '\\', '"', '\'', '$':
+		decoded = r
+	case '\n':
+		// line continuation
+	case 'u':
+		decoded = l.readUnicodeEscape(start)
+	default:
+		l.report(ErrInvalidEscape, start, fmt.Sprintf("unknown escape sequence \\%c", r),
+			"use \\\\ for a literal backslash, or a raw\"...\" string")
+		if out != nil {
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		}
+	}
+	if decoded >= 0 && out != nil {
+		out.WriteRune(decoded)
+	}
+}
+
+// readUnicodeEscape decodes the {XXXX} part of a \u{XXXX} escape, returning
+// -1 if it is malformed
+func (l *Lexer) readUnicodeEscape(start position) rune {
+	const hint = "write unicode escapes as \\u{1F916}"
+	if l.peek(0) != '{' {
+		l.report(ErrInvalidEscape, start, "expected '{' after \\u", hint)
+		return -1
+	}
+	l.advance() // {
+
+	digitsStart := l.pos
+	for l.pos < len(l.input) && isHexDigit(l.input[l.pos]) {
+		l.advance()
+	}
+	digits := l.input[digitsStart:l.pos]
+	if l.peek(0) != '}' || digits == "" || len(digits) > 6 {
+		l.report(ErrInvalidEscape, start, "malformed unicode escape", hint)
+		return -1
+	}
+	l.advance() // }
+
+	n, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(n)) {
+		l.report(ErrInvalidEscape, start, fmt.Sprintf("invalid code point U+%s", strings.ToUpper(digits)), "")
+		return -1
+	}
+	return rune(n)
+}
+
+func isHexDigit(ch byte) bool {
+	return ('0' <= ch && ch <= '9') || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
+
+// maxInterpolationDepth limits how deeply ${...} interpolations may nest
+const maxInterpolationDepth = 8
+
+// readInterpolation reads a ${...} expression inside a string and lexes its
+// contents with a sub-lexer positioned at the expression's source location
+func (l *Lexer) readInterpolation() token.StringPart {
+	start := l.mark()
+	l.advance() // $
+	l.advance() // {
+
+	inner := l.mark()
+	begin := l.pos
+	depth := 1
+	for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+		ch := l.input[l.pos]
+		if ch == '{' {
+			depth++
+		} else if ch == '}' {
+			depth--
+			if depth == 0 {
+				break
+			}
+		} else if ch == '"' || ch == '\'' {
+			l.skipNestedString(ch)
+			continue
+		}
+		l.advance()
+	}
+	expr := l.input[begin:l.pos]
+
+	if depth == 0 {
+		l.advance() // }
+	} else {
+		l.report(ErrUnterminatedInterp, start, "unterminated string interpolation",
+			"close the expression with `}`")
+	}
+
+	// Every level of nesting lexes its expression again, so deep nesting
+	// would make lexing quadratic
+	if l.depth >= maxInterpolationDepth {
+		l.report(ErrInterpolationDepth, start, "string interpolation nested too deeply",
+			"move the inner expression into a variable")
+		return token.StringPart{Expr: true, Rejected: true}
+	}
+
+	if l.compact {
+		// Scan keeps no tokens, so lex the expression in place rather than
+		// with a new lexer, and keep only the diagnostics
+		outer := *l
+		l.input, l.base, l.pos, l.depth, l.pragmaAt, l.stmt = expr, inner.offset, 0, l.depth+1, -1, statementState{}
+		l.line, l.column, l.utf16Column = inner.line, inner.column, inner.utf16Column
+		for {
+			if tokenType, _ := l.lex(); tokenType == token.EOF {
+				break
+			}
+		}
+		errors := l.errors
+		*l = outer
+		l.errors = errors
+		return token.StringPart{Expr: true}
+	}
+
+	sub := New(expr)
+	sub.edition, sub.pragmaAt, sub.depth = l.edition, -1, l.depth+1
+	sub.base, sub.line, sub.column, sub.utf16Column = inner.offset, inner.line, inner.column, inner.utf16Column
+	tokens := sub.Tokenize()
+	l.errors = append(l.errors, sub.Errors()...)
+
+	return token.StringPart{Expr: true, Tokens: tokens[:len(tokens)-1]} // drop EOF
+}
+
+// skipNestedString skips over a string literal inside an interpolation so
+// its quotes and braces don't end the expression early
+func (l *Lexer) skipNestedString(quote byte) {
+	l.advance() // opening quote
+	for l.pos < len(l.input) && l.input[l.pos] != quote && l.input[l.pos] != '\n' {
+		if l.input[l.pos] == '\\' && l.pos+1 < len(l.input) {
+			l.advance()
+		}
+		l.advance()
+	}
+	if l.pos < len(l.input) && l.input[l.pos] == quote {
+		l.advance() // closing quote
+	}
+}
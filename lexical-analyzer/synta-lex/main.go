@@ -0,0 +1,114 @@
+// main.go - Synta Lexer CLI
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	lexer "synta-compiler/lexical-analyzer"
+	"synta-compiler/token"
+)
+
+func main() {
+	inputFile := flag.String("input", "", "Input .synta source file")
+	outputFile := flag.String("output", "tokens.json", "Output token file")
+	errorsFile := flag.String("errors", "lex-errors.txt", "Lexical errors file")
+	trivia := flag.Bool("trivia", false, "Keep whitespace and comments as token trivia (lossless)")
+	indent := flag.Bool("indent", false, "Emit INDENT/DEDENT tokens for blocks opened by a trailing ':'")
+	edition := flag.Int("edition", int(token.DefaultEdition), "Language edition for files without an edition pragma")
+
+	flag.Parse()
+
+	printHeader()
+
+	if *inputFile == "" {
+		fmt.Println("❌ no input file given")
+		printUsage()
+		os.Exit(1)
+	}
+
+	src, err := os.ReadFile(*inputFile)
+	if err != nil {
+		fmt.Printf("❌ error reading source file: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, ok := token.ParseEdition(fmt.Sprint(*edition)); !ok {
+		fmt.Printf("❌ unknown edition %d\n", *edition)
+		os.Exit(1)
+	}
+	opts := []lexer.Option{lexer.WithEdition(token.Edition(*edition))}
+	if *trivia {
+		opts = append(opts, lexer.WithTrivia())
+	}
+	if *indent {
+		opts = append(opts, lexer.WithIndentation())
+	}
+	l := lexer.New(string(src), opts...)
+	tokens := l.Tokenize()
+	fmt.Printf("📄 Lexed %d tokens from %s\n", len(tokens), *inputFile)
+
+	data, err := json.MarshalIndent(token.NewFile(*inputFile, src, tokens), "", "  ")
+	if err != nil {
+		fmt.Printf("❌ Error marshaling tokens: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*outputFile, data, 0644); err != nil {
+		fmt.Printf("❌ Error writing token file: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("📦 Tokens written to %s (format v%d)\n", *outputFile, token.FormatVersion)
+
+	errors := l.Errors()
+	content := ""
+	for _, e := range errors {
+		content += e.Error() + "\n"
+	}
+	if err := os.WriteFile(*errorsFile, []byte(content), 0644); err != nil {
+		fmt.Printf("⚠️  Could not write errors file: %v\n", err)
+	}
+
+	if len(errors) > 0 {
+		fmt.Printf("\n⚠️  Lexing completed with %d error(s), see %s\n", len(errors), *errorsFile)
+		for i, e := range errors {
+			if i >= 5 {
+				fmt.Printf("... and %d more error(s)\n", len(errors)-5)
+				break
+			}
+			fmt.Printf("  %d. %s\n", i+1, e.Error())
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("✓  No errors (empty file: %s)\n", *errorsFile)
+}
+
+func printHeader() {
+	fmt.Println(strings.Repeat("=", 70))
+	fmt.Println("  Synta Lexical Analyzer")
+	fmt.Println(strings.Repeat("=", 70))
+	fmt.Println()
+}
+
+func printUsage() {
+	fmt.Println("\nUsage:")
+	fmt.Println("  synta-lex -input file.synta [options]")
+	fmt.Println("\nOptions:")
+	fmt.Println("  -input string")
+	fmt.Println("        Input .synta source file")
+	fmt.Println("  -output string")
+	fmt.Println("        Output token file (default: tokens.json)")
+	fmt.Println("  -errors string")
+	fmt.Println("        Lexical errors file (default: lex-errors.txt)")
+	fmt.Println("  -trivia")
+	fmt.Println("        Keep whitespace and comments as token trivia (lossless)")
+	fmt.Println("  -indent")
+	fmt.Println("        Emit INDENT/DEDENT tokens for blocks opened by a trailing ':'")
+	fmt.Println("  -edition int")
+	fmt.Println("        Language edition for files without an edition pragma (default: 2025)")
+	fmt.Println("\nExamples:")
+	fmt.Println("  synta-lex -input examples/snippet.synta")
+	fmt.Println("  synta-lex -input code.synta -output my_tokens.json")
+	fmt.Println("  synta-lex -input code.synta -trivia")
+}
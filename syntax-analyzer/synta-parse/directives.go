@@ -0,0 +1,58 @@
+// directives.go - listing and running shell directives (!pip install ...)
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	parser "synta-compiler/syntax-analyzer/synta-parse/parser"
+)
+
+// shellBuiltins are commands a directive may start with that are not
+// programs on PATH
+var shellBuiltins = map[string]bool{
+	"cd": true, "export": true, "source": true, ".": true, "set": true, "unset": true,
+}
+
+// listDirectives prints each directive and whether its command can be found
+func listDirectives(directives []*parser.DirectiveStatement) {
+	fmt.Printf("\n🐚 %d shell directive(s)\n", len(directives))
+	for _, d := range directives {
+		status := "✓"
+		if err := checkDirective(d); err != nil {
+			status = "⚠️  " + err.Error()
+		}
+		fmt.Printf("  Line %d: !%s  %s\n", d.Token.Line, d.Command, status)
+	}
+}
+
+// checkDirective reports a directive whose program isn't installed
+func checkDirective(d *parser.DirectiveStatement) error {
+	fields := strings.Fields(d.Command)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	if shellBuiltins[fields[0]] {
+		return nil
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return fmt.Errorf("%s not found", fields[0])
+	}
+	return nil
+}
+
+// runDirectives runs the directives in order with sh, stopping at the first
+// one that fails
+func runDirectives(directives []*parser.DirectiveStatement) error {
+	for _, d := range directives {
+		fmt.Printf("\n$ %s\n", d.Command)
+		cmd := exec.Command("sh", "-c", d.Command)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("line %d: %v", d.Token.Line, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Package driver lexes and parses many Synta files at once
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	lexer "synta-compiler/lexical-analyzer"
+	parser "synta-compiler/syntax-analyzer/synta-parse/parser"
+)
+
+// Options configures a Run
+type Options struct {
+	// Workers is how many files are lexed and parsed at once. Zero or less
+	// means runtime.GOMAXPROCS(0).
+	Workers int
+	// Indentation lexes every file in indentation mode, so blocks such as
+	// `with open(path) as f:` parse
+	Indentation bool
+	// Lexer options applied to every file
+	Lexer []lexer.Option
+}
+
+// Result is the outcome for one file. Errors holds the lexical errors
+// followed by the parse errors; Err is set instead if the file couldn't be
+// read, in which case Program is nil.
+type Result struct {
+	Path    string
+	Program *parser.Program
+	Errors  []error
+	Err     error
+}
+
+// FileError is an error from one of the files in a Run
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// Files expands args into a list of source files. An argument may be a
+// file, a directory (every .synta file under it) or a glob pattern. Files
+// are returned in the order their arguments were given, sorted within a
+// directory or glob, and each file only once.
+func Files(args ...string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %q", arg)
+			}
+			for _, m := range matches {
+				add(m)
+			}
+			continue
+		}
+
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && filepath.Ext(path) == ".synta" {
+				add(path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Run lexes and parses paths concurrently on a bounded pool of workers. The
+// results are in the order of paths, and the aggregated errors are in file
+// order and then source order, however the work was scheduled.
+func Run(paths []string, opts Options) ([]Result, []FileError) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(paths))
+
+	lexOpts := append([]lexer.Option{}, opts.Lexer...)
+	if opts.Indentation {
+		lexOpts = append(lexOpts, lexer.WithIndentation())
+	}
+
+	results := make([]Result, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = parseFile(paths[i], lexOpts)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var errs []FileError
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, FileError{Path: r.Path, Err: r.Err})
+		}
+		for _, err := range r.Errors {
+			errs = append(errs, FileError{Path: r.Path, Err: err})
+		}
+	}
+	return results, errs
+}
+
+// parseFile lexes and parses a single file, streaming tokens from the
+// lexer into the parser
+func parseFile(path string, opts []lexer.Option) Result {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		// FileError already names the file
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return Result{Path: path, Err: err}
+	}
+
+	lex := lexer.New(string(src), opts...)
+	program, parseErrors, _ := parser.NewStream(lex).Parse()
+
+	var errs []error
+	for _, d := range lex.Errors() {
+		errs = append(errs, d)
+	}
+	return Result{Path: path, Program: program, Errors: append(errs, parseErrors...)}
+}
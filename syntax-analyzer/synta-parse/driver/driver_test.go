@@ -0,0 +1,88 @@
+package driver
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.synta", "a.synta", "notes.txt", "sub/c.synta"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x := 1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Files(filepath.Join(dir, "b.synta"), dir, filepath.Join(dir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"b.synta", "a.synta", "sub/c.synta", "notes.txt"}
+	for i := range want {
+		want[i] = filepath.Join(dir, filepath.FromSlash(want[i]))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Files:\n got %v\nwant %v", got, want)
+	}
+
+	if _, err := Files(filepath.Join(dir, "*.go")); err == nil {
+		t.Error("expected an error for a glob without matches")
+	}
+}
+
+// TestRunDeterministic checks that results and errors come back in the same
+// order however many workers share the files
+func TestRunDeterministic(t *testing.T) {
+	paths, err := Files("../../../examples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.synta")
+	paths = append(paths, missing, paths[0])
+
+	results, errs := Run(paths, Options{Workers: 1})
+	for i, r := range results {
+		if r.Path != paths[i] {
+			t.Fatalf("result %d is for %s, want %s", i, r.Path, paths[i])
+		}
+	}
+	if r := results[len(paths)-2]; !errors.Is(r.Err, fs.ErrNotExist) || r.Program != nil {
+		t.Errorf("missing file: got %v, %v", r.Err, r.Program)
+	}
+
+	for range 5 {
+		_, parallel := Run(paths, Options{Workers: 8})
+		if !reflect.DeepEqual(messages(parallel), messages(errs)) {
+			t.Fatal("errors differ between a serial and a parallel run")
+		}
+	}
+}
+
+func messages(errs []FileError) []string {
+	out := make([]string, len(errs))
+	for i, e := range errs {
+		out[i] = e.Error()
+	}
+	return out
+}
+
+func TestRunIndentation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "with.synta")
+	if err := os.WriteFile(path, []byte("with open(p) as f:\n    x =: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, errs := Run([]string{path}, Options{}); len(errs) == 0 {
+		t.Error("expected errors without indentation mode")
+	}
+	if _, errs := Run([]string{path}, Options{Indentation: true}); len(errs) > 0 {
+		t.Errorf("unexpected errors in indentation mode: %v", errs)
+	}
+}
@@ -0,0 +1,67 @@
+// files.go - lexing and parsing several source files at once
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"synta-compiler/syntax-analyzer/synta-parse/driver"
+	parser "synta-compiler/syntax-analyzer/synta-parse/parser"
+)
+
+// parseFiles lexes and parses the files named by args (files, directories
+// or globs) in parallel, reports each one and writes every error to
+// errorsFile. It returns false if any file failed.
+func parseFiles(args []string, opts driver.Options, errorsFile, format string, show bool) bool {
+	paths, err := driver.Files(args...)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return false
+	}
+
+	results, errs := driver.Run(paths, opts)
+	fmt.Printf("📄 Parsed %d file(s)\n\n", len(results))
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			fmt.Printf("  ❌ %s: %v\n", r.Path, r.Err)
+		case len(r.Errors) > 0:
+			fmt.Printf("  ⚠️  %s: %d error(s)\n", r.Path, len(r.Errors))
+		default:
+			fmt.Printf("  ✅ %s: %d statement(s)\n", r.Path, len(r.Program.Statements))
+		}
+	}
+
+	if show {
+		for _, r := range results {
+			// Like a single file, a tree is only shown for a clean parse
+			if r.Program == nil || len(r.Errors) > 0 {
+				continue
+			}
+			fmt.Println("\n" + strings.Repeat("=", 70))
+			fmt.Println(r.Path)
+			fmt.Println(strings.Repeat("=", 70))
+			fmt.Println(generateTree(r.Program, format))
+		}
+	}
+
+	if len(errs) == 0 {
+		if err := os.WriteFile(errorsFile, []byte(""), 0644); err != nil {
+			fmt.Printf("⚠️  Could not write errors file: %v\n", err)
+		}
+		fmt.Printf("\n✅ All files parsed successfully\n")
+		return true
+	}
+
+	errors := make([]error, len(errs))
+	for i, e := range errs {
+		errors[i] = e
+	}
+	if err := parser.WriteErrors(errorsFile, errors); err != nil {
+		fmt.Printf("Error writing errors file: %v\n", err)
+	} else {
+		fmt.Printf("\n📝 %d error(s) written to %s\n", len(errs), errorsFile)
+	}
+	return false
+}
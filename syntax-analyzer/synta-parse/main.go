@@ -7,12 +7,15 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	lexer "synta-compiler/lexical-analyzer"
+	"synta-compiler/syntax-analyzer/synta-parse/driver"
 	parser "synta-compiler/syntax-analyzer/synta-parse/parser"
 )
 
 func main() {
 	// Define all flags
 	inputFile := flag.String("input", "tokens.json", "Input token file")
+	sourceFile := flag.String("source", "", "Lex and parse a .synta source file directly (overrides -input)")
 	treeFile := flag.String("tree", "parse-tree.txt", "Output parse tree file")
 	astFile := flag.String("ast", "ast.json", "Output AST JSON file")
 	errorsFile := flag.String("errors", "parse-errors.txt", "Parse errors file")
@@ -21,25 +24,81 @@ func main() {
 	showConsole := flag.Bool("show", false, "Show tree in console")
 	skipAST := flag.Bool("skip-ast", false, "Skip AST JSON generation")
 	skipDebug := flag.Bool("skip-debug", false, "Skip debug log generation")
+	listDirs := flag.Bool("directives", false, "List shell directives (!pip install ...) and check their commands")
+	runDirs := flag.Bool("run-directives", false, "Run shell directives in order before reporting")
+	jobs := flag.Int("jobs", 0, "Files to parse at once when given several (default: number of CPUs)")
+	indent := flag.Bool("indent", false, "Lex source files in indentation mode, for blocks such as `with ... as f:`")
 
 	flag.Parse()
 
 	// Print header
 	printHeader()
 
-	// Load tokens
-	tokens, err := parser.LoadTokens(*inputFile)
-	if err != nil {
-		fmt.Printf("❌ %v\n", err)
-		printUsage()
-		os.Exit(1)
+	// Source files, directories or globs after the flags are parsed together
+	if flag.NArg() > 0 {
+		opts := driver.Options{Workers: *jobs, Indentation: *indent}
+		if !parseFiles(flag.Args(), opts, *errorsFile, *format, *showConsole) {
+			os.Exit(1)
+		}
+		return
 	}
 
-	fmt.Printf("📄 Loaded %d tokens from %s\n", len(tokens), *inputFile)
+	var p *parser.Parser
+	var lex *lexer.Lexer
+	if *sourceFile != "" {
+		// Stream tokens straight from the lexer into the parser
+		f, err := os.Open(*sourceFile)
+		if err != nil {
+			fmt.Printf("❌ error reading source file: %v\n", err)
+			os.Exit(1)
+		}
+		var opts []lexer.Option
+		if *indent {
+			opts = append(opts, lexer.WithIndentation())
+		}
+		lex, err = lexer.NewReader(f, opts...)
+		f.Close()
+		if err != nil {
+			fmt.Printf("❌ error reading source file: %v\n", err)
+			os.Exit(1)
+		}
+		p = parser.NewStream(lex)
+		fmt.Printf("📄 Lexing and parsing %s\n", *sourceFile)
+	} else {
+		// Load tokens
+		tokens, err := parser.LoadTokens(*inputFile)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			printUsage()
+			os.Exit(1)
+		}
+
+		fmt.Printf("📄 Loaded %d tokens from %s\n", len(tokens), *inputFile)
+		p = parser.New(tokens)
+	}
 
-	// Create parser and parse
-	p := parser.New(tokens)
+	// Parse
 	program, errors, debugLog := p.Parse()
+	if lex != nil {
+		// Lexical errors come first, they usually explain the parse errors
+		var lexErrors []error
+		for _, d := range lex.Errors() {
+			lexErrors = append(lexErrors, d)
+		}
+		errors = append(lexErrors, errors...)
+	}
+
+	// Shell directives don't depend on the rest of the file parsing cleanly
+	if *listDirs || *runDirs {
+		directives := parser.Directives(program)
+		listDirectives(directives)
+		if *runDirs {
+			if err := runDirectives(directives); err != nil {
+				fmt.Printf("\n❌ Directive failed: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
 
 	// Handle parsing errors
 	if len(errors) > 0 {
@@ -80,15 +139,7 @@ func main() {
 	fmt.Printf("📊 Total statements parsed: %d\n\n", len(program.Statements))
 
 	// Generate and write parse tree
-	var treeContent string
-	switch *format {
-	case "compact":
-		treeContent = parser.GenerateCompactTree(program)
-	case "detailed":
-		treeContent = parser.GenerateDetailedTree(program)
-	default:
-		treeContent = parser.GeneratePrettyTree(program)
-	}
+	treeContent := generateTree(program, *format)
 
 	if err := os.WriteFile(*treeFile, []byte(treeContent), 0644); err != nil {
 		fmt.Printf("❌ Error writing tree file: %v\n", err)
@@ -139,6 +190,18 @@ func main() {
 	printSummary(program, *format)
 }
 
+// generateTree renders program in the named tree format
+func generateTree(program *parser.Program, format string) string {
+	switch format {
+	case "compact":
+		return parser.GenerateCompactTree(program)
+	case "detailed":
+		return parser.GenerateDetailedTree(program)
+	default:
+		return parser.GeneratePrettyTree(program)
+	}
+}
+
 func printHeader() {
 	fmt.Println(strings.Repeat("=", 70))
 	fmt.Println("  Synta Syntax Analyzer")
@@ -150,9 +213,12 @@ func printHeader() {
 func printUsage() {
 	fmt.Println("\nUsage:")
 	fmt.Println("  synta-parse [options]")
+	fmt.Println("  synta-parse [options] file|dir|glob ...")
 	fmt.Println("\nOptions:")
 	fmt.Println("  -input string")
 	fmt.Println("        Input token file (default: tokens.json)")
+	fmt.Println("  -source string")
+	fmt.Println("        Lex and parse a .synta source file directly (overrides -input)")
 	fmt.Println("  -tree string")
 	fmt.Println("        Output parse tree file (default: parse-tree.txt)")
 	fmt.Println("  -ast string")
@@ -169,10 +235,22 @@ func printUsage() {
 	fmt.Println("        Skip AST JSON generation")
 	fmt.Println("  -skip-debug")
 	fmt.Println("        Skip debug log generation")
+	fmt.Println("  -directives")
+	fmt.Println("        List shell directives (!pip install ...) and check their commands")
+	fmt.Println("  -run-directives")
+	fmt.Println("        Run shell directives in order before reporting")
+	fmt.Println("  -jobs int")
+	fmt.Println("        Files to parse at once when given several (default: number of CPUs)")
+	fmt.Println("  -indent")
+	fmt.Println("        Lex source files in indentation mode, for blocks such as `with ... as f:`")
 	fmt.Println("\nExamples:")
 	fmt.Println("  synta-parse")
 	fmt.Println("  synta-parse -input my_tokens.json -format compact -show")
+	fmt.Println("  synta-parse -source examples/snippet.synta -show")
 	fmt.Println("  synta-parse -skip-ast -skip-debug")
+	fmt.Println("  synta-parse -source examples/2-superfinetune.synta -directives")
+	fmt.Println("  synta-parse -indent -source examples/2-superfinetune.synta")
+	fmt.Println("  synta-parse -jobs 4 'examples/*.synta'")
 }
 
 func printSummary(program *parser.Program, format string) {
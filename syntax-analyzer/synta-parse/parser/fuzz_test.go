@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lexer "synta-compiler/lexical-analyzer"
+	"synta-compiler/token"
+)
+
+// FuzzParse feeds lexed source to the parser, which must neither panic nor
+// get stuck, however broken the input. Large seeds make the fuzzer slow to
+// minimize, so run it with e.g. -fuzzminimizetime 5s.
+func FuzzParse(f *testing.F) {
+	files, err := filepath.Glob("../../../examples/*.synta")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(src))
+	}
+	for _, src := range []string{"", "fn f(a, b) { return a + b }", "x := [1, {", "if a { with b as c:\n  d\n", "@agent(", "a == == =: 1"} {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		parse(t, lexer.New(src).Tokenize())
+		parse(t, lexer.New(src, lexer.WithIndentation()).Tokenize())
+	})
+}
+
+// parse runs the parser on tokens and fails if it doesn't finish in time
+func parse(t *testing.T, tokens []token.Token) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		New(tokens).Parse()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("parser doesn't terminate on %d tokens", len(tokens))
+	}
+}
@@ -4,7 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"synta-compiler/token"
 )
 
 // ============================================================================
@@ -15,6 +20,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Pos // start of the node in the source
+	End() token.Pos // position just past the node
 }
 
 // Statement nodes
@@ -32,6 +39,7 @@ type Expression interface {
 // Program is the root node of the AST
 type Program struct {
 	Statements []Statement
+	Edition    token.Edition // from the file's edition pragma, 0 if it has none
 }
 
 func (p *Program) TokenLiteral() string {
@@ -41,6 +49,20 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Pos {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Pos{}
+}
+
+func (p *Program) End() token.Pos {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Pos{}
+}
+
 func (p *Program) String() string {
 	var out strings.Builder
 	for _, s := range p.Statements {
@@ -50,103 +72,239 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// DocComment is a run of consecutive !>> lines documenting the declaration
+// that follows them
+type DocComment struct {
+	Lines []token.Token
+	Text  string // the lines joined, without their !>> markers
+}
+
+// posOf returns the start of n, or of tok when n is missing after a parse error
+func posOf(n Node, tok token.Token) token.Pos {
+	if n == nil {
+		return tok.Span.Start
+	}
+	return n.Pos()
+}
+
+// stringOf returns n.String(), or "" when n is missing after a parse error
+func stringOf(n Node) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+// endOf returns the end of n, or of tok when n is missing after a parse error
+func endOf(n Node, tok token.Token) token.Pos {
+	if n == nil {
+		return tok.Span.End
+	}
+	return n.End()
+}
+
 // Identifier
 type Identifier struct {
-	Token Token
+	Token token.Token
 	Value string
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Lexeme }
+func (i *Identifier) Pos() token.Pos       { return i.Token.Span.Start }
+func (i *Identifier) End() token.Pos       { return i.Token.Span.End }
 func (i *Identifier) String() string       { return i.Value }
 
 // IntegerLiteral
 type IntegerLiteral struct {
-	Token Token
+	Token token.Token
 	Value string
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Lexeme }
+func (il *IntegerLiteral) Pos() token.Pos       { return il.Token.Span.Start }
+func (il *IntegerLiteral) End() token.Pos       { return il.Token.Span.End }
 func (il *IntegerLiteral) String() string       { return il.Value }
 
 // FloatLiteral
 type FloatLiteral struct {
-	Token Token
+	Token token.Token
 	Value string
 }
 
 func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Lexeme }
+func (fl *FloatLiteral) Pos() token.Pos       { return fl.Token.Span.Start }
+func (fl *FloatLiteral) End() token.Pos       { return fl.Token.Span.End }
 func (fl *FloatLiteral) String() string       { return fl.Value }
 
+// DurationLiteral: 120s, 500ms, 1.5h
+type DurationLiteral struct {
+	Token token.Token
+	Value time.Duration
+}
+
+func (dl *DurationLiteral) expressionNode()      {}
+func (dl *DurationLiteral) TokenLiteral() string { return dl.Token.Lexeme }
+func (dl *DurationLiteral) Pos() token.Pos       { return dl.Token.Span.Start }
+func (dl *DurationLiteral) End() token.Pos       { return dl.Token.Span.End }
+func (dl *DurationLiteral) String() string       { return dl.Token.Lexeme }
+
 // StringLiteral
 type StringLiteral struct {
-	Token Token
+	Token token.Token
 	Value string
 }
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Lexeme }
-func (sl *StringLiteral) String() string       { return fmt.Sprintf("\"%s\"", sl.Value) }
+func (sl *StringLiteral) Pos() token.Pos       { return sl.Token.Span.Start }
+func (sl *StringLiteral) End() token.Pos       { return sl.Token.Span.End }
+func (sl *StringLiteral) String() string       { return strconv.Quote(sl.Value) }
+
+// InterpolatedString: "Load CSV: ${filepath}"
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression // *StringLiteral for text, any expression for ${...}
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Lexeme }
+func (is *InterpolatedString) Pos() token.Pos       { return is.Token.Span.Start }
+func (is *InterpolatedString) End() token.Pos       { return is.Token.Span.End }
+func (is *InterpolatedString) String() string {
+	var out strings.Builder
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if sl, ok := part.(*StringLiteral); ok {
+			out.WriteString(sl.Value)
+		} else if part != nil {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	out.WriteString("\"")
+	return out.String()
+}
 
 // BooleanLiteral
 type BooleanLiteral struct {
-	Token Token
+	Token token.Token
 	Value bool
 }
 
 func (bl *BooleanLiteral) expressionNode()      {}
 func (bl *BooleanLiteral) TokenLiteral() string { return bl.Token.Lexeme }
-func (bl *BooleanLiteral) String() string       { return bl.Token.Lexeme }
+func (bl *BooleanLiteral) Pos() token.Pos       { return bl.Token.Span.Start }
+func (bl *BooleanLiteral) End() token.Pos       { return bl.Token.Span.End }
+func (bl *BooleanLiteral) String() string       { return strconv.FormatBool(bl.Value) }
+
+// NullLiteral: null (or None)
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Lexeme }
+func (nl *NullLiteral) Pos() token.Pos       { return nl.Token.Span.Start }
+func (nl *NullLiteral) End() token.Pos       { return nl.Token.Span.End }
+func (nl *NullLiteral) String() string       { return "null" }
+
+// MarshalJSON gives null literals an explicit Value in the AST JSON, like
+// the other literals
+func (nl *NullLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Token token.Token
+		Value any
+	}{nl.Token, nil})
+}
 
 // BindStatement: bind x := 10
 type BindStatement struct {
-	Token Token
+	Token token.Token
 	Name  *Identifier
 	Value Expression
 }
 
 func (bs *BindStatement) statementNode()       {}
 func (bs *BindStatement) TokenLiteral() string { return bs.Token.Lexeme }
+func (bs *BindStatement) Pos() token.Pos       { return bs.Token.Span.Start }
+func (bs *BindStatement) End() token.Pos       { return endOf(bs.Value, bs.Name.Token) }
 func (bs *BindStatement) String() string {
 	return fmt.Sprintf("bind %s := %s", bs.Name.String(), bs.Value.String())
 }
 
 // ConstStatement: const PI := 3.14
 type ConstStatement struct {
-	Token Token
+	Token token.Token
 	Name  *Identifier
 	Value Expression
+	Doc   *DocComment
 }
 
 func (cs *ConstStatement) statementNode()       {}
 func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Lexeme }
+func (cs *ConstStatement) Pos() token.Pos       { return cs.Token.Span.Start }
+func (cs *ConstStatement) End() token.Pos       { return endOf(cs.Value, cs.Name.Token) }
 func (cs *ConstStatement) String() string {
 	return fmt.Sprintf("const %s := %s", cs.Name.String(), cs.Value.String())
 }
 
-// AssignStatement: x =: 20
+// AssignStatement: x =: 20, also to an index, a member or a tuple of
+// targets, as in a, b =: b, a
 type AssignStatement struct {
-	Token Token
-	Name  *Identifier
-	Value Expression
+	Token  token.Token
+	Target Expression
+	Value  Expression
 }
 
 func (as *AssignStatement) statementNode()       {}
 func (as *AssignStatement) TokenLiteral() string { return as.Token.Lexeme }
+func (as *AssignStatement) Pos() token.Pos       { return posOf(as.Target, as.Token) }
+func (as *AssignStatement) End() token.Pos       { return endOf(as.Value, as.Token) }
 func (as *AssignStatement) String() string {
-	return fmt.Sprintf("%s =: %s", as.Name.String(), as.Value.String())
+	return fmt.Sprintf("%s =: %s", as.Target.String(), as.Value.String())
+}
+
+// CompoundAssignStatement: x += 1, and likewise -=, *=, /= and %=
+type CompoundAssignStatement struct {
+	Token    token.Token
+	Operator string
+	Target   Expression
+	Value    Expression
+}
+
+func (cs *CompoundAssignStatement) statementNode()       {}
+func (cs *CompoundAssignStatement) TokenLiteral() string { return cs.Token.Lexeme }
+func (cs *CompoundAssignStatement) Pos() token.Pos       { return posOf(cs.Target, cs.Token) }
+func (cs *CompoundAssignStatement) End() token.Pos       { return endOf(cs.Value, cs.Token) }
+func (cs *CompoundAssignStatement) String() string {
+	return fmt.Sprintf("%s %s %s", cs.Target.String(), cs.Operator, cs.Value.String())
+}
+
+// IncDecStatement: i++ or i--
+type IncDecStatement struct {
+	Token    token.Token
+	Operator string
+	Target   Expression
 }
 
+func (is *IncDecStatement) statementNode()       {}
+func (is *IncDecStatement) TokenLiteral() string { return is.Token.Lexeme }
+func (is *IncDecStatement) Pos() token.Pos       { return posOf(is.Target, is.Token) }
+func (is *IncDecStatement) End() token.Pos       { return is.Token.Span.End }
+func (is *IncDecStatement) String() string       { return is.Target.String() + is.Operator }
+
 // ReturnStatement: return x
 type ReturnStatement struct {
-	Token       Token
+	Token       token.Token
 	ReturnValue Expression
 }
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Lexeme }
+func (rs *ReturnStatement) Pos() token.Pos       { return rs.Token.Span.Start }
+func (rs *ReturnStatement) End() token.Pos       { return endOf(rs.ReturnValue, rs.Token) }
 func (rs *ReturnStatement) String() string {
 	if rs.ReturnValue != nil {
 		return fmt.Sprintf("return %s", rs.ReturnValue.String())
@@ -156,12 +314,14 @@ func (rs *ReturnStatement) String() string {
 
 // ExpressionStatement
 type ExpressionStatement struct {
-	Token      Token
+	Token      token.Token
 	Expression Expression
 }
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Lexeme }
+func (es *ExpressionStatement) Pos() token.Pos       { return posOf(es.Expression, es.Token) }
+func (es *ExpressionStatement) End() token.Pos       { return endOf(es.Expression, es.Token) }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -169,14 +329,23 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
-// BlockStatement
+// BlockStatement: { ... }, or an indented block between INDENT and DEDENT
 type BlockStatement struct {
-	Token      Token
+	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token // the closing '}' or DEDENT
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Lexeme }
+func (bs *BlockStatement) Pos() token.Pos       { return bs.Token.Span.Start }
+func (bs *BlockStatement) End() token.Pos {
+	// A DEDENT sits at the start of the line after the block
+	if bs.Rbrace.Type == token.DEDENT && len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Rbrace.Span.End
+}
 func (bs *BlockStatement) String() string {
 	var out strings.Builder
 	out.WriteString("{\n")
@@ -191,7 +360,7 @@ func (bs *BlockStatement) String() string {
 
 // IfStatement
 type IfStatement struct {
-	Token       Token
+	Token       token.Token
 	Condition   Expression
 	Consequence *BlockStatement
 	Alternative Statement
@@ -199,6 +368,13 @@ type IfStatement struct {
 
 func (is *IfStatement) statementNode()       {}
 func (is *IfStatement) TokenLiteral() string { return is.Token.Lexeme }
+func (is *IfStatement) Pos() token.Pos       { return is.Token.Span.Start }
+func (is *IfStatement) End() token.Pos {
+	if is.Alternative != nil {
+		return is.Alternative.End()
+	}
+	return is.Consequence.End()
+}
 func (is *IfStatement) String() string {
 	var out strings.Builder
 	out.WriteString("if ")
@@ -214,20 +390,54 @@ func (is *IfStatement) String() string {
 
 // WhileStatement
 type WhileStatement struct {
-	Token     Token
+	Token     token.Token
 	Condition Expression
 	Body      *BlockStatement
 }
 
 func (ws *WhileStatement) statementNode()       {}
 func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Lexeme }
+func (ws *WhileStatement) Pos() token.Pos       { return ws.Token.Span.Start }
+func (ws *WhileStatement) End() token.Pos       { return ws.Body.End() }
 func (ws *WhileStatement) String() string {
 	return fmt.Sprintf("while %s %s", ws.Condition.String(), ws.Body.String())
 }
 
+// DirectiveStatement: a line-leading shell command such as !pip install unsloth
+type DirectiveStatement struct {
+	Token   token.Token
+	Command string
+}
+
+func (ds *DirectiveStatement) statementNode()       {}
+func (ds *DirectiveStatement) TokenLiteral() string { return ds.Token.Lexeme }
+func (ds *DirectiveStatement) Pos() token.Pos       { return ds.Token.Span.Start }
+func (ds *DirectiveStatement) End() token.Pos       { return ds.Token.Span.End }
+func (ds *DirectiveStatement) String() string       { return "!" + ds.Command }
+
+// WithStatement: with open(path) as f: followed by an indented block, or
+// with a brace-delimited body
+type WithStatement struct {
+	Token   token.Token
+	Context Expression
+	Target  *Identifier // nil without 'as'
+	Body    *BlockStatement
+}
+
+func (ws *WithStatement) statementNode()       {}
+func (ws *WithStatement) TokenLiteral() string { return ws.Token.Lexeme }
+func (ws *WithStatement) Pos() token.Pos       { return ws.Token.Span.Start }
+func (ws *WithStatement) End() token.Pos       { return ws.Body.End() }
+func (ws *WithStatement) String() string {
+	if ws.Target == nil {
+		return fmt.Sprintf("with %s %s", ws.Context.String(), ws.Body.String())
+	}
+	return fmt.Sprintf("with %s as %s %s", ws.Context.String(), ws.Target.String(), ws.Body.String())
+}
+
 // ForStatement
 type ForStatement struct {
-	Token    Token
+	Token    token.Token
 	Variable *Identifier
 	Iterable Expression
 	Body     *BlockStatement
@@ -235,56 +445,209 @@ type ForStatement struct {
 
 func (fs *ForStatement) statementNode()       {}
 func (fs *ForStatement) TokenLiteral() string { return fs.Token.Lexeme }
+func (fs *ForStatement) Pos() token.Pos       { return fs.Token.Span.Start }
+func (fs *ForStatement) End() token.Pos       { return fs.Body.End() }
 func (fs *ForStatement) String() string {
 	return fmt.Sprintf("for %s in %s %s", fs.Variable.String(), fs.Iterable.String(), fs.Body.String())
 }
 
-// FunctionStatement
+// FunctionStatement: [async] fn name(a: int, b =: 1) => type { ... }
 type FunctionStatement struct {
-	Token      Token
+	Token      token.Token
+	Async      bool
+	AsyncToken token.Token // the 'async' keyword when Async is set
 	Name       *Identifier
-	Parameters []*Identifier
+	Parameters []*Parameter
+	Arrow      token.Token // '=>' or '->' before ReturnType
+	ReturnType Expression  // nil if not annotated
 	Body       *BlockStatement
+	Doc        *DocComment
 }
 
 func (fs *FunctionStatement) statementNode()       {}
 func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Lexeme }
+func (fs *FunctionStatement) Pos() token.Pos {
+	if fs.Async {
+		return fs.AsyncToken.Span.Start
+	}
+	return fs.Token.Span.Start
+}
+func (fs *FunctionStatement) End() token.Pos { return fs.Body.End() }
 func (fs *FunctionStatement) String() string {
+	var out strings.Builder
+	if fs.Async {
+		out.WriteString("async ")
+	}
 	params := []string{}
 	for _, p := range fs.Parameters {
 		params = append(params, p.String())
 	}
-	return fmt.Sprintf("fn %s(%s) %s", fs.Name.String(), strings.Join(params, ", "), fs.Body.String())
+	out.WriteString(fmt.Sprintf("fn %s(%s) ", fs.Name.String(), strings.Join(params, ", ")))
+	if fs.ReturnType != nil {
+		out.WriteString(fs.Arrow.Lexeme + " " + fs.ReturnType.String() + " ")
+	}
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+// Parameter is a function parameter with its optional type and default
+type Parameter struct {
+	Name    *Identifier
+	Type    Expression // nil if untyped
+	Default Expression // nil without a default
+}
+
+func (pa *Parameter) TokenLiteral() string { return pa.Name.TokenLiteral() }
+func (pa *Parameter) Pos() token.Pos       { return pa.Name.Pos() }
+func (pa *Parameter) End() token.Pos {
+	if pa.Default != nil {
+		return pa.Default.End()
+	}
+	if pa.Type != nil {
+		return pa.Type.End()
+	}
+	return pa.Name.End()
+}
+func (pa *Parameter) String() string {
+	out := pa.Name.String()
+	if pa.Type != nil {
+		out += ": " + pa.Type.String()
+	}
+	if pa.Default != nil {
+		out += " =: " + pa.Default.String()
+	}
+	return out
+}
+
+// TypeName is a type annotation such as int, string or object
+type TypeName struct {
+	Token token.Token
+	Value string
 }
 
+func (tn *TypeName) expressionNode()      {}
+func (tn *TypeName) TokenLiteral() string { return tn.Token.Lexeme }
+func (tn *TypeName) Pos() token.Pos       { return tn.Token.Span.Start }
+func (tn *TypeName) End() token.Pos       { return tn.Token.Span.End }
+func (tn *TypeName) String() string       { return tn.Value }
+
 // PrintStatement
 type PrintStatement struct {
-	Token      Token
+	Token      token.Token
 	Expression Expression
 }
 
 func (ps *PrintStatement) statementNode()       {}
 func (ps *PrintStatement) TokenLiteral() string { return ps.Token.Lexeme }
+func (ps *PrintStatement) Pos() token.Pos       { return ps.Token.Span.Start }
+func (ps *PrintStatement) End() token.Pos       { return endOf(ps.Expression, ps.Token) }
 func (ps *PrintStatement) String() string {
 	return fmt.Sprintf("print %s", ps.Expression.String())
 }
 
+// Field is one `key: value` or `key =: value` setting in a declaration
+type Field struct {
+	Key    token.Token
+	Assign token.Token // the ':' or '=:'
+	Value  Expression
+}
+
+func (f *Field) String() string {
+	return fmt.Sprintf("%s: %s", f.Key.Lexeme, f.Value.String())
+}
+
+func fieldsString(fields []*Field) string {
+	out := []string{}
+	for _, f := range fields {
+		out = append(out, f.String())
+	}
+	return "{ " + strings.Join(out, ", ") + " }"
+}
+
+// AgentDeclaration: @agent Name { role: "...", tools: [...], ... }. Settings
+// the language knows about get their own field; the rest are kept in
+// Extras. Fields holds every setting in source order.
+type AgentDeclaration struct {
+	Token                 token.Token
+	Name                  *Identifier
+	Role                  Expression
+	Tools                 *ArrayLiteral
+	Model                 Expression
+	Mode                  Expression
+	SysPrompt             Expression
+	MaxConcurrentRequests *IntegerLiteral
+	Timeout               *DurationLiteral
+	Priority              Expression
+	Extras                []*Field
+	Fields                []*Field
+	Rbrace                token.Token
+	Doc                   *DocComment
+}
+
+func (ad *AgentDeclaration) statementNode()       {}
+func (ad *AgentDeclaration) TokenLiteral() string { return ad.Token.Lexeme }
+func (ad *AgentDeclaration) Pos() token.Pos       { return ad.Token.Span.Start }
+func (ad *AgentDeclaration) End() token.Pos       { return ad.Rbrace.Span.End }
+func (ad *AgentDeclaration) String() string {
+	return fmt.Sprintf("@agent %s %s", ad.Name.String(), fieldsString(ad.Fields))
+}
+
+// TaskDeclaration: task name { input: data, agent: Worker, ... }. Like an
+// agent, known properties get their own field and the rest go in Extras.
+type TaskDeclaration struct {
+	Token          token.Token
+	Name           *Identifier
+	Input          Expression
+	Agent          Expression
+	Action         Expression
+	DependsOn      *ArrayLiteral
+	Concurrency    Expression
+	RetryOnFailure Expression
+	MaxRetries     *IntegerLiteral
+	Extras         []*Field
+	Fields         []*Field
+	Rbrace         token.Token
+	Doc            *DocComment
+}
+
+func (td *TaskDeclaration) statementNode()       {}
+func (td *TaskDeclaration) TokenLiteral() string { return td.Token.Lexeme }
+func (td *TaskDeclaration) Pos() token.Pos       { return td.Token.Span.Start }
+func (td *TaskDeclaration) End() token.Pos       { return td.Rbrace.Span.End }
+func (td *TaskDeclaration) String() string {
+	return fmt.Sprintf("task %s %s", td.Name.String(), fieldsString(td.Fields))
+}
+
+// TaskBlock: an anonymous @task { ... } block of statements
+type TaskBlock struct {
+	Token token.Token
+	Body  *BlockStatement
+}
+
+func (tb *TaskBlock) statementNode()       {}
+func (tb *TaskBlock) TokenLiteral() string { return tb.Token.Lexeme }
+func (tb *TaskBlock) Pos() token.Pos       { return tb.Token.Span.Start }
+func (tb *TaskBlock) End() token.Pos       { return tb.Body.End() }
+func (tb *TaskBlock) String() string       { return "@task " + tb.Body.String() }
+
 // PrefixExpression
 type PrefixExpression struct {
-	Token    Token
+	Token    token.Token
 	Operator string
 	Right    Expression
 }
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Lexeme }
+func (pe *PrefixExpression) Pos() token.Pos       { return pe.Token.Span.Start }
+func (pe *PrefixExpression) End() token.Pos       { return endOf(pe.Right, pe.Token) }
 func (pe *PrefixExpression) String() string {
-	return fmt.Sprintf("(%s%s)", pe.Operator, pe.Right.String())
+	return fmt.Sprintf("(%s%s)", pe.Operator, stringOf(pe.Right))
 }
 
 // InfixExpression
 type InfixExpression struct {
-	Token    Token
+	Token    token.Token
 	Left     Expression
 	Operator string
 	Right    Expression
@@ -292,104 +655,145 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Lexeme }
+func (ie *InfixExpression) Pos() token.Pos       { return posOf(ie.Left, ie.Token) }
+func (ie *InfixExpression) End() token.Pos       { return endOf(ie.Right, ie.Token) }
 func (ie *InfixExpression) String() string {
-	return fmt.Sprintf("(%s %s %s)", ie.Left.String(), ie.Operator, ie.Right.String())
+	return fmt.Sprintf("(%s %s %s)", stringOf(ie.Left), ie.Operator, stringOf(ie.Right))
 }
 
 // CallExpression
 type CallExpression struct {
-	Token     Token
+	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Lexeme }
+func (ce *CallExpression) Pos() token.Pos       { return posOf(ce.Function, ce.Token) }
+func (ce *CallExpression) End() token.Pos       { return ce.Rparen.Span.End }
 func (ce *CallExpression) String() string {
 	args := []string{}
 	for _, a := range ce.Arguments {
-		args = append(args, a.String())
+		args = append(args, stringOf(a))
 	}
-	return fmt.Sprintf("%s(%s)", ce.Function.String(), strings.Join(args, ", "))
+	return fmt.Sprintf("%s(%s)", stringOf(ce.Function), strings.Join(args, ", "))
 }
 
 // ArrayLiteral
 type ArrayLiteral struct {
-	Token    Token
+	Token    token.Token
 	Elements []Expression
+	Rbracket token.Token
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Lexeme }
+func (al *ArrayLiteral) Pos() token.Pos       { return al.Token.Span.Start }
+func (al *ArrayLiteral) End() token.Pos       { return al.Rbracket.Span.End }
 func (al *ArrayLiteral) String() string {
 	elements := []string{}
 	for _, e := range al.Elements {
-		elements = append(elements, e.String())
+		elements = append(elements, stringOf(e))
 	}
 	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
 }
 
+// TupleExpression: a, b on either side of an assignment
+type TupleExpression struct {
+	Token    token.Token // the first ','
+	Elements []Expression
+}
+
+func (te *TupleExpression) expressionNode()      {}
+func (te *TupleExpression) TokenLiteral() string { return te.Token.Lexeme }
+func (te *TupleExpression) Pos() token.Pos       { return posOf(te.Elements[0], te.Token) }
+func (te *TupleExpression) End() token.Pos {
+	return endOf(te.Elements[len(te.Elements)-1], te.Token)
+}
+func (te *TupleExpression) String() string {
+	elements := []string{}
+	for _, e := range te.Elements {
+		elements = append(elements, stringOf(e))
+	}
+	return strings.Join(elements, ", ")
+}
+
+// MapLiteral: { name: "Jay", "age": 20, [key]: value }
+type MapLiteral struct {
+	Token  token.Token
+	Pairs  []*MapEntry // in source order
+	Rbrace token.Token
+}
+
+func (ml *MapLiteral) expressionNode()      {}
+func (ml *MapLiteral) TokenLiteral() string { return ml.Token.Lexeme }
+func (ml *MapLiteral) Pos() token.Pos       { return ml.Token.Span.Start }
+func (ml *MapLiteral) End() token.Pos       { return ml.Rbrace.Span.End }
+func (ml *MapLiteral) String() string {
+	pairs := []string{}
+	for _, e := range ml.Pairs {
+		pairs = append(pairs, e.String())
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+// MapEntry is one key/value pair of a MapLiteral. Key is an *Identifier
+// for bare names, a *StringLiteral for quoted ones, or any expression when
+// Computed, as in [key]: value.
+type MapEntry struct {
+	Key      Expression
+	Computed bool
+	Value    Expression
+}
+
+func (me *MapEntry) String() string {
+	if me.Computed {
+		return fmt.Sprintf("[%s]: %s", stringOf(me.Key), stringOf(me.Value))
+	}
+	return fmt.Sprintf("%s: %s", stringOf(me.Key), stringOf(me.Value))
+}
+
+// MemberExpression: object.property
+type MemberExpression struct {
+	Token    token.Token // the '.'
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Lexeme }
+func (me *MemberExpression) Pos() token.Pos       { return posOf(me.Object, me.Token) }
+func (me *MemberExpression) End() token.Pos       { return me.Property.End() }
+func (me *MemberExpression) String() string {
+	return fmt.Sprintf("(%s.%s)", stringOf(me.Object), me.Property.String())
+}
+
 // IndexExpression
 type IndexExpression struct {
-	Token Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Lexeme }
+func (ie *IndexExpression) Pos() token.Pos       { return posOf(ie.Left, ie.Token) }
+func (ie *IndexExpression) End() token.Pos       { return ie.Rbracket.Span.End }
 func (ie *IndexExpression) String() string {
-	return fmt.Sprintf("(%s[%s])", ie.Left.String(), ie.Index.String())
+	return fmt.Sprintf("(%s[%s])", stringOf(ie.Left), stringOf(ie.Index))
 }
 
-// GetNodePosition returns the token line and column for a node if available
+// GetNodePosition returns the line and column where a node starts, or 0, 0
+// for a nil node
 func GetNodePosition(n Node) (line int, column int) {
-	switch v := n.(type) {
-	case *Identifier:
-		return v.Token.Line, v.Token.Column
-	case *IntegerLiteral:
-		return v.Token.Line, v.Token.Column
-	case *FloatLiteral:
-		return v.Token.Line, v.Token.Column
-	case *StringLiteral:
-		return v.Token.Line, v.Token.Column
-	case *BooleanLiteral:
-		return v.Token.Line, v.Token.Column
-	case *BindStatement:
-		return v.Token.Line, v.Token.Column
-	case *ConstStatement:
-		return v.Token.Line, v.Token.Column
-	case *AssignStatement:
-		return v.Token.Line, v.Token.Column
-	case *ReturnStatement:
-		return v.Token.Line, v.Token.Column
-	case *ExpressionStatement:
-		return v.Token.Line, v.Token.Column
-	case *BlockStatement:
-		return v.Token.Line, v.Token.Column
-	case *IfStatement:
-		return v.Token.Line, v.Token.Column
-	case *WhileStatement:
-		return v.Token.Line, v.Token.Column
-	case *ForStatement:
-		return v.Token.Line, v.Token.Column
-	case *FunctionStatement:
-		return v.Token.Line, v.Token.Column
-	case *PrintStatement:
-		return v.Token.Line, v.Token.Column
-	case *PrefixExpression:
-		return v.Token.Line, v.Token.Column
-	case *InfixExpression:
-		return v.Token.Line, v.Token.Column
-	case *CallExpression:
-		return v.Token.Line, v.Token.Column
-	case *ArrayLiteral:
-		return v.Token.Line, v.Token.Column
-	case *IndexExpression:
-		return v.Token.Line, v.Token.Column
-	default:
+	if n == nil {
 		return 0, 0
 	}
+	pos := n.Pos()
+	return pos.Line, pos.Column
 }
 
 // ============================================================================
@@ -408,26 +812,27 @@ const (
 	INDEX       // array[index]
 )
 
-var precedences = map[TokenType]int{
-	EQ:       EQUALS,
-	NEQ:      EQUALS,
-	LT:       LESSGREATER,
-	GT:       LESSGREATER,
-	LTE:      LESSGREATER,
-	GTE:      LESSGREATER,
-	PLUS:     SUM,
-	MINUS:    SUM,
-	DIVIDE:   PRODUCT,
-	MULTIPLY: PRODUCT,
-	MODULO:   PRODUCT,
-	LPAREN:   CALL,
-	LBRACKET: INDEX,
-	AND:      LOWEST + 1,
-	OR:       LOWEST + 1,
+var precedences = map[token.TokenType]int{
+	token.EQ:       EQUALS,
+	token.NEQ:      EQUALS,
+	token.LT:       LESSGREATER,
+	token.GT:       LESSGREATER,
+	token.LTE:      LESSGREATER,
+	token.GTE:      LESSGREATER,
+	token.PLUS:     SUM,
+	token.MINUS:    SUM,
+	token.DIVIDE:   PRODUCT,
+	token.MULTIPLY: PRODUCT,
+	token.MODULO:   PRODUCT,
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+	token.AND:      LOWEST + 1,
+	token.OR:       LOWEST + 1,
 }
 
 type ParseError struct {
-	Tok Token
+	Tok token.Token
 	Msg string
 }
 
@@ -435,15 +840,45 @@ func (e ParseError) Error() string {
 	return fmt.Sprintf("Line %d:%d: %s (%s)", e.Tok.Line, e.Tok.Column, e.Msg, e.Tok.Lexeme)
 }
 
+// TokenSource yields tokens one at a time and keeps returning EOF once
+// exhausted. *lexer.Lexer satisfies it, so the parser can consume tokens
+// lazily instead of from a fully materialized slice.
+type TokenSource interface {
+	NextToken() token.Token
+}
+
+// sliceSource adapts an already lexed token slice to TokenSource
+type sliceSource struct {
+	tokens []token.Token
+	pos    int
+}
+
+func (s *sliceSource) NextToken() token.Token {
+	if s.pos >= len(s.tokens) {
+		// Place a synthesized EOF just past the last token
+		eof := token.Token{Type: token.EOF}
+		if n := len(s.tokens); n > 0 {
+			last := s.tokens[n-1]
+			eof.Line = last.Line
+			eof.Column = last.Column + utf8.RuneCountInString(last.Lexeme)
+			eof.Span = token.Span{Start: last.Span.End, End: last.Span.End}
+		}
+		return eof
+	}
+	tok := s.tokens[s.pos]
+	s.pos++
+	return tok
+}
+
 type Parser struct {
-	tokens   []Token
-	pos      int
-	curToken Token
-	errors   []error
-	debugLog []string
+	source    TokenSource
+	lookahead []token.Token
+	curToken  token.Token
+	errors    []error
+	debugLog  []string
 
-	prefixParseFns map[TokenType]prefixParseFn
-	infixParseFns  map[TokenType]infixParseFn
+	prefixParseFns map[token.TokenType]prefixParseFn
+	infixParseFns  map[token.TokenType]infixParseFn
 }
 
 type (
@@ -451,55 +886,64 @@ type (
 	infixParseFn  func(Expression) Expression
 )
 
-func New(tokens []Token) *Parser {
+// New creates a parser over an already lexed token slice
+func New(tokens []token.Token) *Parser {
+	return NewStream(&sliceSource{tokens: tokens})
+}
+
+// NewStream creates a parser that pulls tokens from src as it needs them
+func NewStream(src TokenSource) *Parser {
 	p := &Parser{
-		tokens:         tokens,
-		pos:            0,
+		source:         src,
 		errors:         []error{},
 		debugLog:       []string{},
-		prefixParseFns: make(map[TokenType]prefixParseFn),
-		infixParseFns:  make(map[TokenType]infixParseFn),
+		prefixParseFns: make(map[token.TokenType]prefixParseFn),
+		infixParseFns:  make(map[token.TokenType]infixParseFn),
 	}
 
 	// Register prefix parse functions
-	p.registerPrefix(IDENTIFIER, p.parseIdentifier)
-	p.registerPrefix(INTEGER, p.parseIntegerLiteral)
-	p.registerPrefix(FLOAT, p.parseFloatLiteral)
-	p.registerPrefix(STRING, p.parseStringLiteral)
-	p.registerPrefix(NOT, p.parsePrefixExpression)
-	p.registerPrefix(MINUS, p.parsePrefixExpression)
-	p.registerPrefix(LPAREN, p.parseGroupedExpression)
-	p.registerPrefix(LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.IDENTIFIER, p.parseIdentifier)
+	p.registerPrefix(token.INTEGER, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.DURATION, p.parseDurationLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
+	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
+	p.registerPrefix(token.NOT, p.parsePrefixExpression)
+	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseMapLiteral)
 
 	// Register infix parse functions
-	p.registerInfix(PLUS, p.parseInfixExpression)
-	p.registerInfix(MINUS, p.parseInfixExpression)
-	p.registerInfix(DIVIDE, p.parseInfixExpression)
-	p.registerInfix(MULTIPLY, p.parseInfixExpression)
-	p.registerInfix(MODULO, p.parseInfixExpression)
-	p.registerInfix(EQ, p.parseInfixExpression)
-	p.registerInfix(NEQ, p.parseInfixExpression)
-	p.registerInfix(LT, p.parseInfixExpression)
-	p.registerInfix(GT, p.parseInfixExpression)
-	p.registerInfix(LTE, p.parseInfixExpression)
-	p.registerInfix(GTE, p.parseInfixExpression)
-	p.registerInfix(AND, p.parseInfixExpression)
-	p.registerInfix(OR, p.parseInfixExpression)
-	p.registerInfix(LPAREN, p.parseCallExpression)
-	p.registerInfix(LBRACKET, p.parseIndexExpression)
-
-	if len(tokens) > 0 {
-		p.curToken = tokens[0]
-	}
+	p.registerInfix(token.PLUS, p.parseInfixExpression)
+	p.registerInfix(token.MINUS, p.parseInfixExpression)
+	p.registerInfix(token.DIVIDE, p.parseInfixExpression)
+	p.registerInfix(token.MULTIPLY, p.parseInfixExpression)
+	p.registerInfix(token.MODULO, p.parseInfixExpression)
+	p.registerInfix(token.EQ, p.parseInfixExpression)
+	p.registerInfix(token.NEQ, p.parseInfixExpression)
+	p.registerInfix(token.LT, p.parseInfixExpression)
+	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LTE, p.parseInfixExpression)
+	p.registerInfix(token.GTE, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+
+	p.curToken = src.NextToken()
 
 	return p
 }
 
-func (p *Parser) registerPrefix(tokenType TokenType, fn prefixParseFn) {
+func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
 
-func (p *Parser) registerInfix(tokenType TokenType, fn infixParseFn) {
+func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
@@ -509,20 +953,39 @@ func (p *Parser) Parse() (*Program, []error, []string) {
 		Statements: []Statement{},
 	}
 
-	for p.curToken.Type != EOF {
-		// Skip newlines and comments
-		if p.curToken.Type == NEWLINE || p.curToken.Type == COMMENT_LINE || p.curToken.Type == COMMENT_MULTI {
+	var doc *DocComment
+	for p.curToken.Type != token.EOF {
+		if p.curToken.Type == token.EDITION {
+			if edition, ok := token.ParseEdition(p.curToken.Value); ok {
+				program.Edition = edition
+			}
+			p.advance()
+			continue
+		}
+
+		if p.curToken.Type == token.DOC_COMMENT {
+			doc = p.parseDocComment()
+			continue
+		}
+
+		// Skip newlines and comments; a blank line detaches a doc comment
+		if p.curToken.Type == token.NEWLINE || p.curToken.Type == token.COMMENT_LINE || p.curToken.Type == token.COMMENT_MULTI {
+			if p.curToken.Type == token.NEWLINE {
+				doc = nil
+			}
 			p.advance()
 			continue
 		}
 
 		// Skip noise words
-		if p.curToken.Type == DO || p.curToken.Type == PLEASE || p.curToken.Type == MAYBE {
+		if p.curToken.Type == token.DO || p.curToken.Type == token.PLEASE || p.curToken.Type == token.MAYBE {
 			p.advance()
 			continue
 		}
 
 		stmt := p.parseStatement()
+		p.attachDoc(stmt, doc)
+		doc = nil
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 			p.log(fmt.Sprintf("Parsed statement: %T", stmt))
@@ -539,38 +1002,92 @@ func (p *Parser) parseStatement() Statement {
 	p.log(fmt.Sprintf("Parsing statement at token: %s", p.curToken.Type.String()))
 
 	switch p.curToken.Type {
-	case BIND, LET:
+	case token.BIND, token.LET:
 		return p.parseBindStatement()
-	case CONST:
+	case token.CONST:
 		return p.parseConstStatement()
-	case RETURN:
+	case token.RETURN:
 		return p.parseReturnStatement()
-	case IF:
+	case token.IF:
 		return p.parseIfStatement()
-	case WHILE:
+	case token.WHILE:
 		return p.parseWhileStatement()
-	case FOR:
+	case token.FOR:
 		return p.parseForStatement()
-	case FN:
+	case token.FN:
 		return p.parseFunctionStatement()
-	case PRINT:
-		return p.parsePrintStatement()
-	case IDENTIFIER:
-		// Check if this is an assignment
-		if p.peekToken().Type == ASSIGN {
-			return p.parseAssignStatement()
+	case token.ASYNC:
+		if p.peekToken().Type == token.FN {
+			async := p.curToken
+			p.advance()
+			stmt := p.parseFunctionStatement()
+			if fn, ok := stmt.(*FunctionStatement); ok {
+				fn.Async, fn.AsyncToken = true, async
+			}
+			return stmt
 		}
 		return p.parseExpressionStatement()
+	case token.PRINT:
+		return p.parsePrintStatement()
+	case token.WITH:
+		return p.parseWithStatement()
+	case token.SHELL_DIRECTIVE:
+		return p.parseDirectiveStatement()
+	case token.AT_AGENT:
+		return p.parseAgentDeclaration()
+	case token.TASK:
+		return p.parseTaskDeclaration()
+	case token.AT_TASK:
+		return p.parseTaskBlock()
+	case token.INDENT:
+		p.error(p.curToken, "unexpected indented block")
+		return p.parseBlock(token.DEDENT)
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
+// parseDocComment reads a run of !>> lines, leaving the parser on the
+// token after the line break that ends the run
+func (p *Parser) parseDocComment() *DocComment {
+	doc := &DocComment{}
+	lines := []string{}
+	for p.curToken.Type == token.DOC_COMMENT {
+		doc.Lines = append(doc.Lines, p.curToken)
+		lines = append(lines, strings.TrimPrefix(p.curToken.Lexeme, " "))
+		p.advance()
+		if p.curToken.Type == token.NEWLINE {
+			p.advance()
+		}
+	}
+	doc.Text = strings.Join(lines, "\n")
+	return doc
+}
+
+// attachDoc gives doc to stmt if stmt is a declaration that can carry one
+func (p *Parser) attachDoc(stmt Statement, doc *DocComment) {
+	if doc == nil {
+		return
+	}
+	switch s := stmt.(type) {
+	case *FunctionStatement:
+		s.Doc = doc
+	case *ConstStatement:
+		s.Doc = doc
+	case *AgentDeclaration:
+		s.Doc = doc
+	case *TaskDeclaration:
+		s.Doc = doc
+	default:
+		p.log(fmt.Sprintf("Doc comment at line %d is not followed by a declaration", doc.Lines[0].Line))
+	}
+}
+
 func (p *Parser) parseBindStatement() Statement {
 	stmt := &BindStatement{Token: p.curToken}
 
 	p.advance()
-	if p.curToken.Type != IDENTIFIER {
+	if p.curToken.Type != token.IDENTIFIER {
 		p.error(p.curToken, "expected identifier after 'bind'")
 		return nil
 	}
@@ -578,7 +1095,7 @@ func (p *Parser) parseBindStatement() Statement {
 	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
 
 	p.advance()
-	if p.curToken.Type != BIND_ASSIGN {
+	if p.curToken.Type != token.BIND_ASSIGN {
 		p.error(p.curToken, "expected ':=' after identifier")
 		return nil
 	}
@@ -593,7 +1110,7 @@ func (p *Parser) parseConstStatement() Statement {
 	stmt := &ConstStatement{Token: p.curToken}
 
 	p.advance()
-	if p.curToken.Type != IDENTIFIER {
+	if p.curToken.Type != token.IDENTIFIER {
 		p.error(p.curToken, "expected identifier after 'const'")
 		return nil
 	}
@@ -601,7 +1118,7 @@ func (p *Parser) parseConstStatement() Statement {
 	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
 
 	p.advance()
-	if p.curToken.Type != BIND_ASSIGN {
+	if p.curToken.Type != token.BIND_ASSIGN {
 		p.error(p.curToken, "expected ':=' after identifier")
 		return nil
 	}
@@ -612,26 +1129,130 @@ func (p *Parser) parseConstStatement() Statement {
 	return stmt
 }
 
-func (p *Parser) parseAssignStatement() Statement {
-	stmt := &AssignStatement{}
-	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
+// parseAssignStatement parses from the '=:' after target to the end of the
+// value, which may be a tuple. The value is parsed even when the target
+// is rejected, so parsing resumes after the statement. valid is false when
+// target didn't parse, in which case the error is already reported.
+func (p *Parser) parseAssignStatement(target Expression, valid bool) Statement {
+	ok := valid && p.checkAssignable(target, true)
+	stmt := &AssignStatement{Token: p.curToken, Target: target}
 
-	p.advance() // Move to =:
-	stmt.Token = p.curToken
+	p.advance()
+	stmt.Value = p.parseTuple(p.parseExpression(LOWEST))
+	if !ok || stmt.Value == nil {
+		return nil
+	}
+	p.skipStatementEnd()
+
+	return stmt
+}
+
+func (p *Parser) parseCompoundAssignStatement(target Expression, valid bool) Statement {
+	ok := valid && p.checkAssignable(target, false)
+	stmt := &CompoundAssignStatement{Token: p.curToken, Operator: p.curToken.Lexeme, Target: target}
 
-	p.advance() // Move to value
+	p.advance()
 	stmt.Value = p.parseExpression(LOWEST)
+	if !ok || stmt.Value == nil {
+		return nil
+	}
+	p.skipStatementEnd()
 
 	return stmt
 }
 
+func (p *Parser) parseIncDecStatement(target Expression, valid bool) Statement {
+	if !valid || !p.checkAssignable(target, false) {
+		return nil
+	}
+	stmt := &IncDecStatement{Token: p.curToken, Operator: p.curToken.Lexeme, Target: target}
+	p.skipStatementEnd()
+	return stmt
+}
+
+// parseTuple continues first into a tuple if a ',' follows it, leaving
+// the parser on the last element
+func (p *Parser) parseTuple(first Expression) Expression {
+	if first == nil || p.peekToken().Type != token.COMMA {
+		return first
+	}
+	tuple := &TupleExpression{Token: p.peekToken(), Elements: []Expression{first}}
+	for p.peekToken().Type == token.COMMA {
+		p.advance()
+		p.advance()
+		element := p.parseExpression(LOWEST)
+		if element == nil {
+			return nil
+		}
+		tuple.Elements = append(tuple.Elements, element)
+	}
+	return tuple
+}
+
+// assignmentAhead reports whether an assignment operator follows on the
+// current statement, outside any brackets
+func (p *Parser) assignmentAhead() bool {
+	depth := 0
+	for i := 1; ; i++ {
+		switch p.peekAt(i).Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case token.NEWLINE, token.STATEMENT_END, token.SEMICOLON:
+			if depth == 0 {
+				return false
+			}
+		case token.EOF:
+			return false
+		case token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.MULT_ASSIGN, token.DIV_ASSIGN, token.MOD_ASSIGN,
+			token.INCREMENT, token.DECREMENT:
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+}
+
+// checkAssignable reports an error unless target can be assigned to: a
+// name, an index or a member, or with tuples allowed, a tuple of those
+func (p *Parser) checkAssignable(target Expression, tuples bool) bool {
+	switch t := target.(type) {
+	case *Identifier, *IndexExpression, *MemberExpression:
+		return true
+	case *TupleExpression:
+		if !tuples {
+			p.error(p.curToken, fmt.Sprintf("cannot use %s with several targets", p.curToken.Lexeme))
+			return false
+		}
+		for _, e := range t.Elements {
+			if !p.checkAssignable(e, false) {
+				return false
+			}
+		}
+		return true
+	}
+	p.error(p.curToken, fmt.Sprintf("cannot assign to %s", target.String()))
+	return false
+}
+
+// skipStatementEnd moves onto an optional ';' ending the statement
+func (p *Parser) skipStatementEnd() {
+	if p.peekToken().Type == token.STATEMENT_END {
+		p.advance()
+	}
+}
+
 func (p *Parser) parseReturnStatement() Statement {
 	stmt := &ReturnStatement{Token: p.curToken}
 
 	p.advance()
 
 	// Return can be empty
-	if p.curToken.Type == NEWLINE || p.curToken.Type == SEMICOLON || p.curToken.Type == EOF {
+	if p.curToken.Type == token.NEWLINE || p.curToken.Type == token.SEMICOLON || p.curToken.Type == token.EOF {
 		return stmt
 	}
 
@@ -647,7 +1268,7 @@ func (p *Parser) parseIfStatement() Statement {
 	stmt.Condition = p.parseExpression(LOWEST)
 
 	p.advance()
-	if p.curToken.Type != LBRACE {
+	if p.curToken.Type != token.LBRACE {
 		p.error(p.curToken, "expected '{' after if condition")
 		return nil
 	}
@@ -655,13 +1276,13 @@ func (p *Parser) parseIfStatement() Statement {
 	stmt.Consequence = p.parseBlockStatement()
 
 	// Check for elif or else
-	if p.peekToken().Type == ELIF {
+	if p.peekToken().Type == token.ELIF {
 		p.advance()
 		stmt.Alternative = p.parseIfStatement() // Recursive for elif
-	} else if p.peekToken().Type == ELSE {
+	} else if p.peekToken().Type == token.ELSE {
 		p.advance()
 		p.advance()
-		if p.curToken.Type == LBRACE {
+		if p.curToken.Type == token.LBRACE {
 			stmt.Alternative = p.parseBlockStatement()
 		}
 	}
@@ -676,7 +1297,7 @@ func (p *Parser) parseWhileStatement() Statement {
 	stmt.Condition = p.parseExpression(LOWEST)
 
 	p.advance()
-	if p.curToken.Type != LBRACE {
+	if p.curToken.Type != token.LBRACE {
 		p.error(p.curToken, "expected '{' after while condition")
 		return nil
 	}
@@ -690,7 +1311,7 @@ func (p *Parser) parseForStatement() Statement {
 	stmt := &ForStatement{Token: p.curToken}
 
 	p.advance()
-	if p.curToken.Type != IDENTIFIER {
+	if p.curToken.Type != token.IDENTIFIER {
 		p.error(p.curToken, "expected identifier after 'for'")
 		return nil
 	}
@@ -698,8 +1319,8 @@ func (p *Parser) parseForStatement() Statement {
 	stmt.Variable = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
 
 	p.advance()
-	// Expect 'in' keyword
-	if p.curToken.Type != IDENTIFIER || p.curToken.Lexeme != "in" {
+	// Expect 'in', a keyword since edition 2026
+	if p.curToken.Type != token.IN && (p.curToken.Type != token.IDENTIFIER || p.curToken.Lexeme != "in") {
 		p.error(p.curToken, "expected 'in' after for variable")
 		return nil
 	}
@@ -708,7 +1329,7 @@ func (p *Parser) parseForStatement() Statement {
 	stmt.Iterable = p.parseExpression(LOWEST)
 
 	p.advance()
-	if p.curToken.Type != LBRACE {
+	if p.curToken.Type != token.LBRACE {
 		p.error(p.curToken, "expected '{' after for iterable")
 		return nil
 	}
@@ -722,7 +1343,7 @@ func (p *Parser) parseFunctionStatement() Statement {
 	stmt := &FunctionStatement{Token: p.curToken}
 
 	p.advance()
-	if p.curToken.Type != IDENTIFIER {
+	if p.curToken.Type != token.IDENTIFIER {
 		p.error(p.curToken, "expected function name")
 		return nil
 	}
@@ -730,16 +1351,34 @@ func (p *Parser) parseFunctionStatement() Statement {
 	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
 
 	p.advance()
-	if p.curToken.Type != LPAREN {
+	if p.curToken.Type != token.LPAREN {
 		p.error(p.curToken, "expected '(' after function name")
 		return nil
 	}
 
 	stmt.Parameters = p.parseFunctionParameters()
+	if stmt.Parameters == nil {
+		return nil
+	}
 
 	p.advance()
-	if p.curToken.Type != LBRACE {
-		p.error(p.curToken, "expected '{' after function parameters")
+	if p.curToken.Type == token.ARROW || p.curToken.Type == token.FAT_ARROW {
+		stmt.Arrow = p.curToken
+		p.advance()
+		stmt.ReturnType = p.parseType()
+		if stmt.ReturnType == nil {
+			return nil
+		}
+		p.advance()
+	}
+
+	// fn f(a) do { ... } reads as well as fn f(a) { ... }
+	if p.curToken.Type == token.DO {
+		p.advance()
+	}
+
+	if p.curToken.Type != token.LBRACE {
+		p.error(p.curToken, "expected '{' after function signature")
 		return nil
 	}
 
@@ -748,35 +1387,77 @@ func (p *Parser) parseFunctionStatement() Statement {
 	return stmt
 }
 
-func (p *Parser) parseFunctionParameters() []*Identifier {
-	identifiers := []*Identifier{}
+// parseFunctionParameters parses a parameter list from its '(' to the ')',
+// returning nil after an error
+func (p *Parser) parseFunctionParameters() []*Parameter {
+	params := []*Parameter{}
 
 	p.advance()
-	if p.curToken.Type == RPAREN {
-		return identifiers
+	if p.curToken.Type == token.RPAREN {
+		return params
 	}
 
-	identifiers = append(identifiers, &Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Lexeme,
-	})
+	for {
+		param := p.parseParameter()
+		if param == nil {
+			return nil
+		}
+		params = append(params, param)
 
-	for p.peekToken().Type == COMMA {
+		if p.peekToken().Type != token.COMMA {
+			break
+		}
 		p.advance()
 		p.advance()
-		identifiers = append(identifiers, &Identifier{
-			Token: p.curToken,
-			Value: p.curToken.Lexeme,
-		})
 	}
 
 	p.advance()
-	if p.curToken.Type != RPAREN {
+	if p.curToken.Type != token.RPAREN {
 		p.error(p.curToken, "expected ')' after function parameters")
 		return nil
 	}
 
-	return identifiers
+	return params
+}
+
+// parseParameter parses name, name: type, and either followed by a
+// default value written =: value
+func (p *Parser) parseParameter() *Parameter {
+	if p.curToken.Type != token.IDENTIFIER {
+		p.error(p.curToken, "expected parameter name")
+		return nil
+	}
+	param := &Parameter{Name: &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}}
+
+	if p.peekToken().Type == token.COLON {
+		p.advance()
+		p.advance()
+		param.Type = p.parseType()
+		if param.Type == nil {
+			return nil
+		}
+	}
+
+	if p.peekToken().Type == token.ASSIGN {
+		p.advance()
+		p.advance()
+		param.Default = p.parseExpression(LOWEST)
+		if param.Default == nil {
+			return nil
+		}
+	}
+
+	return param
+}
+
+// parseType parses a type annotation. Built-in types like int are
+// keywords, so any word is accepted as a type name.
+func (p *Parser) parseType() Expression {
+	if !isName(p.curToken) {
+		p.error(p.curToken, "expected type name")
+		return nil
+	}
+	return &TypeName{Token: p.curToken, Value: p.curToken.Lexeme}
 }
 
 func (p *Parser) parsePrintStatement() Statement {
@@ -788,32 +1469,365 @@ func (p *Parser) parsePrintStatement() Statement {
 	return stmt
 }
 
+func (p *Parser) parseDirectiveStatement() Statement {
+	stmt := &DirectiveStatement{Token: p.curToken, Command: strings.TrimSpace(p.curToken.Value)}
+	if stmt.Command == "" {
+		p.error(p.curToken, "expected a command after '!'")
+	}
+	if p.peekToken().Type == token.STATEMENT_END {
+		p.advance()
+	}
+	return stmt
+}
+
+func (p *Parser) parseWithStatement() Statement {
+	stmt := &WithStatement{Token: p.curToken}
+
+	p.advance()
+	stmt.Context = p.parseExpression(LOWEST)
+
+	p.advance()
+	if p.curToken.Type == token.AS {
+		p.advance()
+		if p.curToken.Type != token.IDENTIFIER {
+			p.error(p.curToken, "expected identifier after 'as'")
+			return nil
+		}
+		stmt.Target = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
+		p.advance()
+	}
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		stmt.Body = p.parseBlockStatement()
+	case token.COLON:
+		stmt.Body = p.parseIndentedBlock()
+	default:
+		p.error(p.curToken, "expected ':' or '{' after with clause")
+		return nil
+	}
+	if stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseAgentDeclaration() Statement {
+	stmt := &AgentDeclaration{Token: p.curToken}
+
+	p.advance()
+	if p.curToken.Type != token.IDENTIFIER {
+		p.error(p.curToken, "expected agent name after '@agent'")
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
+
+	p.advance()
+	if p.curToken.Type != token.LBRACE {
+		p.error(p.curToken, "expected '{' after agent name")
+		return nil
+	}
+
+	stmt.Fields = p.parseFields(func(f *Field) {
+		switch f.Key.Lexeme {
+		case "role":
+			stmt.Role = f.Value
+		case "model":
+			stmt.Model = f.Value
+		case "mode":
+			stmt.Mode = f.Value
+		case "sys_prompt":
+			stmt.SysPrompt = f.Value
+		case "priority":
+			stmt.Priority = f.Value
+		case "tools":
+			if tools, ok := f.Value.(*ArrayLiteral); ok {
+				stmt.Tools = tools
+			} else {
+				p.error(f.Key, "agent tools must be a list such as [search, calculator]")
+			}
+		case "max_concurrent_requests":
+			if n, ok := f.Value.(*IntegerLiteral); ok {
+				stmt.MaxConcurrentRequests = n
+			} else {
+				p.error(f.Key, "max_concurrent_requests must be an integer")
+			}
+		case "timeout":
+			if d, ok := f.Value.(*DurationLiteral); ok {
+				stmt.Timeout = d
+			} else {
+				p.error(f.Key, "agent timeout must be a duration such as 120s")
+			}
+		default:
+			stmt.Extras = append(stmt.Extras, f)
+		}
+	})
+	stmt.Rbrace = p.curToken
+
+	return stmt
+}
+
+func (p *Parser) parseTaskDeclaration() Statement {
+	stmt := &TaskDeclaration{Token: p.curToken}
+
+	p.advance()
+	if p.curToken.Type != token.IDENTIFIER {
+		p.error(p.curToken, "expected task name after 'task'")
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
+
+	p.advance()
+	if p.curToken.Type != token.LBRACE {
+		p.error(p.curToken, "expected '{' after task name")
+		return nil
+	}
+
+	stmt.Fields = p.parseFields(func(f *Field) {
+		switch f.Key.Lexeme {
+		case "input":
+			stmt.Input = f.Value
+		case "agent":
+			stmt.Agent = f.Value
+		case "action":
+			stmt.Action = f.Value
+		case "concurrency":
+			stmt.Concurrency = f.Value
+		case "retry_on_failure":
+			stmt.RetryOnFailure = f.Value
+		case "depends_on":
+			if deps, ok := f.Value.(*ArrayLiteral); ok {
+				stmt.DependsOn = deps
+			} else {
+				p.error(f.Key, "depends_on must be a list of task names")
+			}
+		case "max_retries":
+			if n, ok := f.Value.(*IntegerLiteral); ok {
+				stmt.MaxRetries = n
+			} else {
+				p.error(f.Key, "max_retries must be an integer")
+			}
+		default:
+			stmt.Extras = append(stmt.Extras, f)
+		}
+	})
+	stmt.Rbrace = p.curToken
+
+	return stmt
+}
+
+// parseTaskBlock parses an anonymous task: @task followed by a braced
+// block, or by ':' and an indented block
+func (p *Parser) parseTaskBlock() Statement {
+	stmt := &TaskBlock{Token: p.curToken}
+
+	p.advance()
+	switch p.curToken.Type {
+	case token.LBRACE:
+		stmt.Body = p.parseBlockStatement()
+	case token.COLON:
+		stmt.Body = p.parseIndentedBlock()
+	default:
+		p.error(p.curToken, "expected '{' or ':' after '@task'")
+		return nil
+	}
+	if stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// parseFields parses the `key: value` settings of a declaration, from its
+// '{' up to the closing '}'. Fields may also be written `key =: value;`,
+// and are separated by ',', ';' or line breaks. A field that doesn't parse
+// is reported and skipped, as is a repeated key. set is called on each
+// field as it's parsed, so checks on the value are reported in source order.
+func (p *Parser) parseFields(set func(*Field)) []*Field {
+	fields := []*Field{}
+	seen := map[string]bool{}
+
+	p.advance()
+	for {
+		for p.curToken.Type == token.NEWLINE || p.curToken.Type == token.COMMENT_LINE || p.curToken.Type == token.COMMENT_MULTI {
+			p.advance()
+		}
+		if p.curToken.Type == token.RBRACE {
+			return fields
+		}
+		if p.curToken.Type == token.EOF {
+			p.error(p.curToken, "expected '}' to close the declaration")
+			return fields
+		}
+
+		if !isName(p.curToken) {
+			p.error(p.curToken, "expected field name")
+			p.skipField()
+			continue
+		}
+		field := &Field{Key: p.curToken}
+
+		p.advance()
+		if p.curToken.Type != token.COLON && p.curToken.Type != token.ASSIGN {
+			p.error(p.curToken, "expected ':' or '=:' after field name")
+			p.skipField()
+			continue
+		}
+		field.Assign = p.curToken
+
+		p.advance()
+		field.Value = p.parseExpression(LOWEST)
+		if field.Value == nil {
+			p.skipField()
+			continue
+		}
+		if seen[field.Key.Lexeme] {
+			p.error(field.Key, fmt.Sprintf("duplicate field %q", field.Key.Lexeme))
+		} else {
+			seen[field.Key.Lexeme] = true
+			fields = append(fields, field)
+			set(field)
+		}
+
+		p.advance()
+		switch p.curToken.Type {
+		case token.COMMA, token.STATEMENT_END:
+			p.advance()
+		case token.NEWLINE, token.RBRACE:
+		default:
+			p.error(p.curToken, "expected ',', ';' or a new line after field value")
+			p.skipField()
+		}
+	}
+}
+
+// skipField moves past the rest of a malformed field: up to the next line
+// break or separator outside brackets, or the '}' that ends the fields
+func (p *Parser) skipField() {
+	depth := 0
+	for p.curToken.Type != token.EOF {
+		switch p.curToken.Type {
+		case token.LBRACE, token.LBRACKET, token.LPAREN:
+			depth++
+		case token.RBRACKET, token.RPAREN:
+			depth--
+		case token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case token.NEWLINE, token.COMMA, token.STATEMENT_END:
+			if depth <= 0 {
+				p.advance()
+				return
+			}
+		}
+		p.advance()
+	}
+}
+
+// isName reports whether tok is a word: an identifier, or a keyword used
+// as a name, as with the `role` and `timeout` fields of an agent
+func isName(tok token.Token) bool {
+	return tok.Type == token.IDENTIFIER || token.LookupKeyword(tok.Lexeme, token.LatestEdition) == tok.Type
+}
+
+// parseIndentedBlock parses the block after a trailing ':', which the lexer
+// marks with INDENT and DEDENT in indentation mode
+func (p *Parser) parseIndentedBlock() *BlockStatement {
+	colon := p.curToken
+	p.advance()
+	for p.curToken.Type == token.NEWLINE || p.curToken.Type == token.COMMENT_LINE || p.curToken.Type == token.COMMENT_MULTI {
+		p.advance()
+	}
+	if p.curToken.Type != token.INDENT {
+		p.error(colon, "expected an indented block after ':' (lex with indentation mode)")
+		return nil
+	}
+	return p.parseBlock(token.DEDENT)
+}
+
 func (p *Parser) parseBlockStatement() *BlockStatement {
+	return p.parseBlock(token.RBRACE)
+}
+
+// parseBlock parses statements from the opening '{' or INDENT up to the
+// matching end token
+func (p *Parser) parseBlock(end token.TokenType) *BlockStatement {
 	block := &BlockStatement{Token: p.curToken}
 	block.Statements = []Statement{}
 
 	p.advance()
 
-	for p.curToken.Type != RBRACE && p.curToken.Type != EOF {
-		// Skip newlines and comments
-		if p.curToken.Type == NEWLINE || p.curToken.Type == COMMENT_LINE || p.curToken.Type == COMMENT_MULTI {
+	var doc *DocComment
+	for p.curToken.Type != end && p.curToken.Type != token.EOF {
+		if p.curToken.Type == token.DOC_COMMENT {
+			doc = p.parseDocComment()
+			continue
+		}
+
+		// Skip newlines and comments; a blank line detaches a doc comment
+		if p.curToken.Type == token.NEWLINE || p.curToken.Type == token.COMMENT_LINE || p.curToken.Type == token.COMMENT_MULTI {
+			if p.curToken.Type == token.NEWLINE {
+				doc = nil
+			}
 			p.advance()
 			continue
 		}
 
 		stmt := p.parseStatement()
+		p.attachDoc(stmt, doc)
+		doc = nil
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.advance()
 	}
+	block.Rbrace = p.curToken
 
 	return block
 }
 
+// parseExpressionStatement parses an expression on its own, or the
+// target of an assignment, compound assignment or increment
 func (p *Parser) parseExpressionStatement() Statement {
 	stmt := &ExpressionStatement{Token: p.curToken}
+	errs := len(p.errors)
 	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
+		return stmt
+	}
+
+	// A tuple is only valid as assignment targets, so a ',' is left alone
+	// unless an assignment follows on the line
+	target := stmt.Expression
+	if p.peekToken().Type == token.COMMA && p.assignmentAhead() {
+		target = p.parseTuple(target)
+		if target == nil {
+			return nil
+		}
+	}
+	// A partly parsed target may have nil operands
+	valid := len(p.errors) == errs
+
+	switch p.peekToken().Type {
+	case token.ASSIGN:
+		p.advance()
+		return p.parseAssignStatement(target, valid)
+	case token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.MULT_ASSIGN, token.DIV_ASSIGN, token.MOD_ASSIGN:
+		p.advance()
+		return p.parseCompoundAssignStatement(target, valid)
+	case token.INCREMENT, token.DECREMENT:
+		p.advance()
+		return p.parseIncDecStatement(target, valid)
+	}
+
+	if _, ok := target.(*TupleExpression); ok {
+		p.advance()
+		p.error(p.curToken, "expected '=:' after assignment targets")
+		return nil
+	}
 	return stmt
 }
 
@@ -826,7 +1840,7 @@ func (p *Parser) parseExpression(precedence int) Expression {
 
 	leftExp := prefix()
 
-	for p.peekToken().Type != SEMICOLON && p.peekToken().Type != NEWLINE && precedence < p.peekPrecedence() {
+	for p.peekToken().Type != token.SEMICOLON && p.peekToken().Type != token.NEWLINE && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken().Type]
 		if infix == nil {
 			return leftExp
@@ -851,8 +1865,61 @@ func (p *Parser) parseFloatLiteral() Expression {
 	return &FloatLiteral{Token: p.curToken, Value: p.curToken.Lexeme}
 }
 
+func (p *Parser) parseDurationLiteral() Expression {
+	value, err := token.ParseDuration(p.curToken.Lexeme)
+	if err != nil {
+		p.error(p.curToken, err.Error())
+		return nil
+	}
+	return &DurationLiteral{Token: p.curToken, Value: value}
+}
+
+func (p *Parser) parseBooleanLiteral() Expression {
+	return &BooleanLiteral{Token: p.curToken, Value: p.curToken.Type == token.TRUE}
+}
+
+func (p *Parser) parseNullLiteral() Expression {
+	return &NullLiteral{Token: p.curToken}
+}
+
 func (p *Parser) parseStringLiteral() Expression {
-	return &StringLiteral{Token: p.curToken, Value: p.curToken.Lexeme}
+	if len(p.curToken.Parts) == 0 {
+		return &StringLiteral{Token: p.curToken, Value: p.curToken.Value}
+	}
+
+	str := &InterpolatedString{Token: p.curToken}
+	for _, part := range p.curToken.Parts {
+		if !part.Expr {
+			str.Parts = append(str.Parts, &StringLiteral{Token: p.curToken, Value: part.Text})
+			continue
+		}
+		if part.Rejected {
+			continue // the lexer has reported it
+		}
+		str.Parts = append(str.Parts, p.parseInterpolation(part.Tokens))
+	}
+	return str
+}
+
+// parseInterpolation parses the tokens of one ${...} expression with a
+// sub-parser. Its errors keep the positions the lexer gave the tokens.
+func (p *Parser) parseInterpolation(tokens []token.Token) Expression {
+	if len(tokens) == 0 {
+		p.error(p.curToken, "empty string interpolation")
+		return nil
+	}
+
+	sub := New(tokens)
+	exp := sub.parseExpression(LOWEST)
+	if sub.peekToken().Type != token.EOF {
+		sub.error(sub.peekToken(), "unexpected token in string interpolation")
+	}
+
+	p.errors = append(p.errors, sub.errors...)
+	for _, line := range sub.debugLog {
+		p.log(line)
+	}
+	return exp
 }
 
 func (p *Parser) parsePrefixExpression() Expression {
@@ -885,7 +1952,7 @@ func (p *Parser) parseGroupedExpression() Expression {
 	p.advance()
 	exp := p.parseExpression(LOWEST)
 	p.advance()
-	if p.curToken.Type != RPAREN {
+	if p.curToken.Type != token.RPAREN {
 		p.error(p.curToken, "expected ')' after grouped expression")
 		return nil
 	}
@@ -894,13 +1961,15 @@ func (p *Parser) parseGroupedExpression() Expression {
 
 func (p *Parser) parseCallExpression(function Expression) Expression {
 	exp := &CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(RPAREN)
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Rparen = p.curToken
 	return exp
 }
 
 func (p *Parser) parseArrayLiteral() Expression {
 	array := &ArrayLiteral{Token: p.curToken}
-	array.Elements = p.parseExpressionList(RBRACKET)
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curToken
 	return array
 }
 
@@ -911,15 +1980,114 @@ func (p *Parser) parseIndexExpression(left Expression) Expression {
 	exp.Index = p.parseExpression(LOWEST)
 
 	p.advance()
-	if p.curToken.Type != RBRACKET {
+	if p.curToken.Type != token.RBRACKET {
 		p.error(p.curToken, "expected ']'")
 		return nil
 	}
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+// parseMapLiteral parses the entries of a map from its '{' to the '}'.
+// Entries are separated by commas and may span lines, and a trailing comma
+// is allowed.
+func (p *Parser) parseMapLiteral() Expression {
+	m := &MapLiteral{Token: p.curToken, Pairs: []*MapEntry{}}
+
+	p.advance()
+	for {
+		p.skipNewlines()
+		if p.curToken.Type == token.RBRACE {
+			m.Rbrace = p.curToken
+			return m
+		}
+
+		entry := p.parseMapEntry()
+		if entry == nil {
+			return nil
+		}
+		m.Pairs = append(m.Pairs, entry)
+
+		p.advance()
+		p.skipNewlines()
+		switch p.curToken.Type {
+		case token.COMMA:
+			p.advance()
+		case token.RBRACE:
+			m.Rbrace = p.curToken
+			return m
+		default:
+			p.error(p.curToken, "expected ',' or '}' after map entry")
+			return nil
+		}
+	}
+}
+
+// parseMapEntry parses key: value, where the key is a name, a string or a
+// [computed] expression. Like declaration fields, entries may also be
+// written key =: value.
+func (p *Parser) parseMapEntry() *MapEntry {
+	entry := &MapEntry{}
+
+	switch {
+	case p.curToken.Type == token.LBRACKET:
+		entry.Computed = true
+		p.advance()
+		entry.Key = p.parseExpression(LOWEST)
+		if entry.Key == nil {
+			return nil
+		}
+		p.advance()
+		if p.curToken.Type != token.RBRACKET {
+			p.error(p.curToken, "expected ']' after computed map key")
+			return nil
+		}
+	case p.curToken.Type == token.STRING:
+		entry.Key = p.parseStringLiteral()
+	case isName(p.curToken):
+		entry.Key = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
+	default:
+		p.error(p.curToken, "expected map key")
+		return nil
+	}
+
+	p.advance()
+	if p.curToken.Type != token.COLON && p.curToken.Type != token.ASSIGN {
+		p.error(p.curToken, "expected ':' after map key")
+		return nil
+	}
+
+	p.advance()
+	entry.Value = p.parseExpression(LOWEST)
+	if entry.Value == nil {
+		return nil
+	}
+
+	return entry
+}
+
+func (p *Parser) parseMemberExpression(object Expression) Expression {
+	exp := &MemberExpression{Token: p.curToken, Object: object}
+
+	p.advance()
+	if !isName(p.curToken) {
+		p.error(p.curToken, "expected property name after '.'")
+		return nil
+	}
+	exp.Property = &Identifier{Token: p.curToken, Value: p.curToken.Lexeme}
 
 	return exp
 }
 
-func (p *Parser) parseExpressionList(end TokenType) []Expression {
+// skipNewlines moves past line breaks and comments
+func (p *Parser) skipNewlines() {
+	for p.curToken.Type == token.NEWLINE || p.curToken.Type == token.COMMENT_LINE || p.curToken.Type == token.COMMENT_MULTI {
+		p.advance()
+	}
+}
+
+func (p *Parser) parseExpressionList(end token.TokenType) []Expression {
 	list := []Expression{}
 
 	p.advance()
@@ -929,7 +2097,7 @@ func (p *Parser) parseExpressionList(end TokenType) []Expression {
 
 	list = append(list, p.parseExpression(LOWEST))
 
-	for p.peekToken().Type == COMMA {
+	for p.peekToken().Type == token.COMMA {
 		p.advance()
 		p.advance()
 		list = append(list, p.parseExpression(LOWEST))
@@ -945,17 +2113,24 @@ func (p *Parser) parseExpressionList(end TokenType) []Expression {
 }
 
 func (p *Parser) advance() {
-	if p.pos < len(p.tokens)-1 {
-		p.pos++
-		p.curToken = p.tokens[p.pos]
+	if p.curToken.Type == token.EOF {
+		return
 	}
+	p.curToken = p.peekToken()
+	p.lookahead = p.lookahead[1:]
 }
 
-func (p *Parser) peekToken() Token {
-	if p.pos+1 < len(p.tokens) {
-		return p.tokens[p.pos+1]
+func (p *Parser) peekToken() token.Token {
+	return p.peekAt(1)
+}
+
+// peekAt returns the token n positions after the current one, pulling from
+// the source as needed
+func (p *Parser) peekAt(n int) token.Token {
+	for len(p.lookahead) < n {
+		p.lookahead = append(p.lookahead, p.source.NextToken())
 	}
-	return Token{Type: EOF}
+	return p.lookahead[n-1]
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -972,7 +2147,7 @@ func (p *Parser) curPrecedence() int {
 	return LOWEST
 }
 
-func (p *Parser) error(tok Token, message string) {
+func (p *Parser) error(tok token.Token, message string) {
 	err := ParseError{Tok: tok, Msg: message}
 	p.errors = append(p.errors, err)
 	p.log(fmt.Sprintf("ERROR: %s", err.Error()))
@@ -986,17 +2161,18 @@ func (p *Parser) log(message string) {
 // Utilities
 // ============================================================================
 
-// LoadTokens reads a JSON token file and unmarshals into []Token
-func LoadTokens(path string) ([]Token, error) {
+// LoadTokens reads a token file written by synta-lex (or a legacy bare
+// token array) and returns its tokens
+func LoadTokens(path string) ([]token.Token, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("error reading token file: %w", err)
 	}
-	var tokens []Token
-	if err := json.Unmarshal(data, &tokens); err != nil {
+	file, err := token.DecodeFile(data)
+	if err != nil {
 		return nil, fmt.Errorf("error parsing token file: %w", err)
 	}
-	return tokens, nil
+	return file.Tokens, nil
 }
 
 // WriteDebugLog writes debug lines to a file
@@ -1020,6 +2196,40 @@ func WriteErrors(path string, errors []error) error {
 	return os.WriteFile(path, []byte(content), 0644)
 }
 
+// Directives returns the shell directives in program, in source order,
+// including those nested in blocks
+func Directives(program *Program) []*DirectiveStatement {
+	var out []*DirectiveStatement
+	var walk func(stmts []Statement)
+	walk = func(stmts []Statement) {
+		for _, stmt := range stmts {
+			switch s := stmt.(type) {
+			case *DirectiveStatement:
+				out = append(out, s)
+			case *BlockStatement:
+				walk(s.Statements)
+			case *IfStatement:
+				walk(s.Consequence.Statements)
+				if s.Alternative != nil {
+					walk([]Statement{s.Alternative})
+				}
+			case *WhileStatement:
+				walk(s.Body.Statements)
+			case *ForStatement:
+				walk(s.Body.Statements)
+			case *FunctionStatement:
+				walk(s.Body.Statements)
+			case *WithStatement:
+				walk(s.Body.Statements)
+			case *TaskBlock:
+				walk(s.Body.Statements)
+			}
+		}
+	}
+	walk(program.Statements)
+	return out
+}
+
 // ============================================================================
 // Tree Generation
 // ============================================================================
@@ -1044,13 +2254,25 @@ func prettyPrintNode(node Node, prefix string, isLast bool) string {
 		sb.WriteString(fmt.Sprintf("%s└── Value: %s\n", prefix, n.Value.String()))
 
 	case *ConstStatement:
+		if n.Doc != nil {
+			sb.WriteString(fmt.Sprintf("%s├── Doc: %q\n", prefix, n.Doc.Text))
+		}
 		sb.WriteString(fmt.Sprintf("%s├── Name: %s\n", prefix, n.Name.Value))
 		sb.WriteString(fmt.Sprintf("%s└── Value: %s\n", prefix, n.Value.String()))
 
 	case *AssignStatement:
-		sb.WriteString(fmt.Sprintf("%s├── Name: %s\n", prefix, n.Name.Value))
+		sb.WriteString(fmt.Sprintf("%s├── Target: %s\n", prefix, n.Target.String()))
+		sb.WriteString(fmt.Sprintf("%s└── Value: %s\n", prefix, n.Value.String()))
+
+	case *CompoundAssignStatement:
+		sb.WriteString(fmt.Sprintf("%s├── Target: %s\n", prefix, n.Target.String()))
+		sb.WriteString(fmt.Sprintf("%s├── Operator: %s\n", prefix, n.Operator))
 		sb.WriteString(fmt.Sprintf("%s└── Value: %s\n", prefix, n.Value.String()))
 
+	case *IncDecStatement:
+		sb.WriteString(fmt.Sprintf("%s├── Target: %s\n", prefix, n.Target.String()))
+		sb.WriteString(fmt.Sprintf("%s└── Operator: %s\n", prefix, n.Operator))
+
 	case *ReturnStatement:
 		if n.ReturnValue != nil {
 			sb.WriteString(fmt.Sprintf("%s└── Value: %s\n", prefix, n.ReturnValue.String()))
@@ -1075,15 +2297,54 @@ func prettyPrintNode(node Node, prefix string, isLast bool) string {
 	case *FunctionStatement:
 		params := []string{}
 		for _, p := range n.Parameters {
-			params = append(params, p.Value)
+			params = append(params, p.String())
+		}
+		if n.Doc != nil {
+			sb.WriteString(fmt.Sprintf("%s├── Doc: %q\n", prefix, n.Doc.Text))
 		}
 		sb.WriteString(fmt.Sprintf("%s├── Name: %s\n", prefix, n.Name.Value))
+		if n.Async {
+			sb.WriteString(fmt.Sprintf("%s├── Async: true\n", prefix))
+		}
 		sb.WriteString(fmt.Sprintf("%s├── Parameters: [%s]\n", prefix, strings.Join(params, ", ")))
+		if n.ReturnType != nil {
+			sb.WriteString(fmt.Sprintf("%s├── Returns: %s\n", prefix, n.ReturnType.String()))
+		}
 		sb.WriteString(fmt.Sprintf("%s└── Body: %d statements\n", prefix, len(n.Body.Statements)))
 
 	case *PrintStatement:
 		sb.WriteString(fmt.Sprintf("%s└── Expression: %s\n", prefix, n.Expression.String()))
 
+	case *DirectiveStatement:
+		sb.WriteString(fmt.Sprintf("%s└── Command: %s\n", prefix, n.Command))
+
+	case *WithStatement:
+		sb.WriteString(fmt.Sprintf("%s├── Context: %s\n", prefix, n.Context.String()))
+		if n.Target != nil {
+			sb.WriteString(fmt.Sprintf("%s├── Target: %s\n", prefix, n.Target.Value))
+		}
+		sb.WriteString(fmt.Sprintf("%s└── Body: %d statements\n", prefix, len(n.Body.Statements)))
+
+	case *AgentDeclaration:
+		if n.Doc != nil {
+			sb.WriteString(fmt.Sprintf("%s├── Doc: %q\n", prefix, n.Doc.Text))
+		}
+		sb.WriteString(fmt.Sprintf("%s├── Name: %s\n", prefix, n.Name.Value))
+		sb.WriteString(prettyFields(n.Fields, prefix))
+
+	case *TaskDeclaration:
+		if n.Doc != nil {
+			sb.WriteString(fmt.Sprintf("%s├── Doc: %q\n", prefix, n.Doc.Text))
+		}
+		sb.WriteString(fmt.Sprintf("%s├── Name: %s\n", prefix, n.Name.Value))
+		if n.DependsOn != nil {
+			sb.WriteString(fmt.Sprintf("%s├── Depends On: %s\n", prefix, n.DependsOn.String()))
+		}
+		sb.WriteString(prettyFields(n.Fields, prefix))
+
+	case *TaskBlock:
+		sb.WriteString(fmt.Sprintf("%s└── Body: %d statements\n", prefix, len(n.Body.Statements)))
+
 	case *ExpressionStatement:
 		sb.WriteString(fmt.Sprintf("%s└── Expression: %s\n", prefix, n.Expression.String()))
 	}
@@ -1091,6 +2352,20 @@ func prettyPrintNode(node Node, prefix string, isLast bool) string {
 	return sb.String()
 }
 
+// prettyFields lists a declaration's fields as the last branches of its node
+func prettyFields(fields []*Field, prefix string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s└── Fields: %d\n", prefix, len(fields)))
+	for i, f := range fields {
+		branch := "├──"
+		if i == len(fields)-1 {
+			branch = "└──"
+		}
+		sb.WriteString(fmt.Sprintf("%s    %s %s\n", prefix, branch, f.String()))
+	}
+	return sb.String()
+}
+
 // GenerateCompactTree creates a compact one-line-per-statement tree
 func GenerateCompactTree(program *Program) string {
 	var sb strings.Builder
@@ -1121,6 +2396,34 @@ func GenerateDetailedTree(program *Program) string {
 		case *FunctionStatement:
 			sb.WriteString(fmt.Sprintf("  Function Name: %s\n", n.Name.Value))
 			sb.WriteString(fmt.Sprintf("  Parameter Count: %d\n", len(n.Parameters)))
+			sb.WriteString(fmt.Sprintf("  Async: %v\n", n.Async))
+			if n.ReturnType != nil {
+				sb.WriteString(fmt.Sprintf("  Return Type: %s\n", n.ReturnType.String()))
+			}
+			sb.WriteString(fmt.Sprintf("  Body Statements: %d\n", len(n.Body.Statements)))
+			if n.Doc != nil {
+				sb.WriteString(fmt.Sprintf("  Doc: %q\n", n.Doc.Text))
+			}
+
+		case *AgentDeclaration:
+			sb.WriteString(fmt.Sprintf("  Agent Name: %s\n", n.Name.Value))
+			sb.WriteString(fmt.Sprintf("  Field Count: %d\n", len(n.Fields)))
+			sb.WriteString(fmt.Sprintf("  Extra Fields: %d\n", len(n.Extras)))
+			if n.Doc != nil {
+				sb.WriteString(fmt.Sprintf("  Doc: %q\n", n.Doc.Text))
+			}
+
+		case *TaskDeclaration:
+			sb.WriteString(fmt.Sprintf("  Task Name: %s\n", n.Name.Value))
+			sb.WriteString(fmt.Sprintf("  Field Count: %d\n", len(n.Fields)))
+			if n.DependsOn != nil {
+				sb.WriteString(fmt.Sprintf("  Dependencies: %d\n", len(n.DependsOn.Elements)))
+			}
+			if n.Doc != nil {
+				sb.WriteString(fmt.Sprintf("  Doc: %q\n", n.Doc.Text))
+			}
+
+		case *TaskBlock:
 			sb.WriteString(fmt.Sprintf("  Body Statements: %d\n", len(n.Body.Statements)))
 
 		case *IfStatement:
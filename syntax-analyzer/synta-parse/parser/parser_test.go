@@ -0,0 +1,435 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lexer "synta-compiler/lexical-analyzer"
+	"synta-compiler/token"
+)
+
+// parseSource parses src and returns the program and the parse errors
+func parseSource(t *testing.T, src string) (*Program, []error) {
+	t.Helper()
+	program, errs, _ := New(lexer.New(src).Tokenize()).Parse()
+	return program, errs
+}
+
+func TestAgentDeclaration(t *testing.T) {
+	program, errs := parseSource(t, `
+@agent Analyst {
+    role: "research",
+    tools: [search, calculator],
+    max_concurrent_requests =: 5;
+    timeout =: 120s;
+    priority: "high"
+    temperature: 0.2,
+}`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(program.Statements) != 1 {
+		t.Fatalf("got %d statements, want 1", len(program.Statements))
+	}
+	agent, ok := program.Statements[0].(*AgentDeclaration)
+	if !ok {
+		t.Fatalf("got %T, want *AgentDeclaration", program.Statements[0])
+	}
+
+	if agent.Name.Value != "Analyst" {
+		t.Errorf("name = %q", agent.Name.Value)
+	}
+	if agent.Role.String() != `"research"` {
+		t.Errorf("role = %s", agent.Role)
+	}
+	if agent.Tools == nil || len(agent.Tools.Elements) != 2 {
+		t.Errorf("tools = %v", agent.Tools)
+	}
+	if agent.MaxConcurrentRequests == nil || agent.MaxConcurrentRequests.Value != "5" {
+		t.Errorf("max_concurrent_requests = %v", agent.MaxConcurrentRequests)
+	}
+	if agent.Timeout == nil || agent.Timeout.String() != "120s" {
+		t.Errorf("timeout = %v", agent.Timeout)
+	}
+	if agent.Priority == nil {
+		t.Error("priority not set")
+	}
+	if len(agent.Extras) != 1 || agent.Extras[0].Key.Lexeme != "temperature" {
+		t.Errorf("extras = %v", agent.Extras)
+	}
+	if len(agent.Fields) != 6 {
+		t.Errorf("got %d fields, want 6", len(agent.Fields))
+	}
+}
+
+func TestAgentDeclarationErrors(t *testing.T) {
+	_, errs := parseSource(t, `@agent Bad { role: "a", role: "b", tools: search, timeout: 5 }`)
+	want := []string{"duplicate field", "tools must be a list", "timeout must be a duration"}
+	if len(errs) != len(want) {
+		t.Fatalf("got errors %v, want %d", errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i].Error(), w) {
+			t.Errorf("error %d = %q, want %q", i, errs[i], w)
+		}
+	}
+}
+
+func TestTaskDeclaration(t *testing.T) {
+	program, errs := parseSource(t, `
+task report {
+    input: results
+    agent: Writer
+    concurrency: parallel
+    depends_on: [analyze, fetch]
+    retry_on_failure: true
+    max_retries =: 3;
+    deadline: 5m
+}
+@task {
+    response =: summarize(Writer, "notes")
+    print(response)
+}`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("got %d statements, want 2", len(program.Statements))
+	}
+
+	task, ok := program.Statements[0].(*TaskDeclaration)
+	if !ok {
+		t.Fatalf("got %T, want *TaskDeclaration", program.Statements[0])
+	}
+	if task.Name.Value != "report" || task.Agent.String() != "Writer" || task.Concurrency.String() != "parallel" {
+		t.Errorf("task = %s", task)
+	}
+	if task.DependsOn == nil || task.DependsOn.String() != "[analyze, fetch]" {
+		t.Errorf("depends_on = %v", task.DependsOn)
+	}
+	if task.RetryOnFailure == nil || task.MaxRetries == nil || task.MaxRetries.Value != "3" {
+		t.Errorf("retry settings = %v, %v", task.RetryOnFailure, task.MaxRetries)
+	}
+	if len(task.Extras) != 1 || task.Extras[0].Key.Lexeme != "deadline" {
+		t.Errorf("extras = %v", task.Extras)
+	}
+
+	block, ok := program.Statements[1].(*TaskBlock)
+	if !ok {
+		t.Fatalf("got %T, want *TaskBlock", program.Statements[1])
+	}
+	if len(block.Body.Statements) != 2 {
+		t.Errorf("got %d statements in @task, want 2", len(block.Body.Statements))
+	}
+}
+
+func TestFunctionSignatures(t *testing.T) {
+	tests := []struct {
+		src   string
+		async bool
+		want  string // parameters and return type, as printed
+	}{
+		{"fn add(a, b) { return a + b }", false, "a, b"},
+		{"fn calculate(a:int, b:int) do { return a }", false, "a: int, b: int"},
+		{"async fn load(path: string) => object { return path }", true, "path: string => object"},
+		{"fn retry(n: int =: 3, delay =: 1s) -> bool { return n }", false, "n: int =: 3, delay =: 1s -> bool"},
+	}
+
+	for _, tt := range tests {
+		program, errs := parseSource(t, tt.src)
+		if len(errs) > 0 {
+			t.Errorf("%s: unexpected errors: %v", tt.src, errs)
+			continue
+		}
+		fn, ok := program.Statements[0].(*FunctionStatement)
+		if !ok {
+			t.Errorf("%s: got %T, want *FunctionStatement", tt.src, program.Statements[0])
+			continue
+		}
+		if fn.Async != tt.async {
+			t.Errorf("%s: Async = %v", tt.src, fn.Async)
+		}
+		params := []string{}
+		for _, p := range fn.Parameters {
+			params = append(params, p.String())
+		}
+		got := strings.Join(params, ", ")
+		if fn.ReturnType != nil {
+			got += " " + fn.Arrow.Lexeme + " " + fn.ReturnType.String()
+		}
+		if got != tt.want {
+			t.Errorf("%s: signature = %q, want %q", tt.src, got, tt.want)
+		}
+		if fn.Pos().Offset != 0 {
+			t.Errorf("%s: Pos = %d, want 0", tt.src, fn.Pos().Offset)
+		}
+	}
+}
+
+func TestMapLiteral(t *testing.T) {
+	program, errs := parseSource(t, `result =: {
+    status: "failed",
+    "code" =: 500,
+    [key]: data.rows[0].id,
+}`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	assign := program.Statements[0].(*AssignStatement)
+	m, ok := assign.Value.(*MapLiteral)
+	if !ok {
+		t.Fatalf("got %T, want *MapLiteral", assign.Value)
+	}
+	want := `{status: "failed", "code": 500, [key]: (((data.rows)[0]).id)}`
+	if m.String() != want {
+		t.Errorf("map = %s, want %s", m, want)
+	}
+	if _, ok := m.Pairs[0].Key.(*Identifier); !ok {
+		t.Errorf("bare key is %T, want *Identifier", m.Pairs[0].Key)
+	}
+	if _, ok := m.Pairs[1].Key.(*StringLiteral); !ok {
+		t.Errorf("quoted key is %T, want *StringLiteral", m.Pairs[1].Key)
+	}
+	if !m.Pairs[2].Computed {
+		t.Error("[key] is not computed")
+	}
+
+	for _, src := range []string{"x =: {}", "x =: {a: 1}", "x =: {a: {b: 2},}"} {
+		if _, errs := parseSource(t, src); len(errs) > 0 {
+			t.Errorf("%s: unexpected errors: %v", src, errs)
+		}
+	}
+	for _, src := range []string{"x =: {1: 2}", "x =: {a: 1 b: 2}", "x =: {a 1}", "x =: {a: 1"} {
+		if _, errs := parseSource(t, src); len(errs) == 0 {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestMemberExpression(t *testing.T) {
+	program, errs := parseSource(t, `x =: send(event.task_id, load(path).rows.count)`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	call := program.Statements[0].(*AssignStatement).Value.(*CallExpression)
+	want := []string{"(event.task_id)", "((load(path).rows).count)"}
+	for i, arg := range call.Arguments {
+		if _, ok := arg.(*MemberExpression); !ok || arg.String() != want[i] {
+			t.Errorf("argument %d = %T %s, want %s", i, arg, arg, want[i])
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // the statement's type and String
+	}{
+		{"x =: 20;", "*parser.AssignStatement x =: 20"},
+		{"results[event.task_id] =: event.result", "*parser.AssignStatement (results[(event.task_id)]) =: (event.result)"},
+		{"obj.field =: x", "*parser.AssignStatement (obj.field) =: x"},
+		{"a, b =: b, a", "*parser.AssignStatement a, b =: b, a"},
+		{"x += 1;", "*parser.CompoundAssignStatement x += 1"},
+		{"total %= n - 1", "*parser.CompoundAssignStatement total %= (n - 1)"},
+		{"i++", "*parser.IncDecStatement i++"},
+		{"counts[k]--", "*parser.IncDecStatement (counts[k])--"},
+	}
+
+	for _, tt := range tests {
+		program, errs := parseSource(t, tt.src)
+		if len(errs) > 0 {
+			t.Errorf("%s: unexpected errors: %v", tt.src, errs)
+			continue
+		}
+		if len(program.Statements) != 1 {
+			t.Errorf("%s: got %d statements, want 1", tt.src, len(program.Statements))
+			continue
+		}
+		stmt := program.Statements[0]
+		if got := fmt.Sprintf("%T %s", stmt, stmt); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := map[string]string{
+		"f() =: 1":       "cannot assign to f()",
+		"1 += 2":         "cannot assign to 1",
+		"a, f() =: 1, 2": "cannot assign to f()",
+		"a, b += 1":      "cannot use += with several targets",
+		"f()++":          "cannot assign to f()",
+		"a == == =: 1":   "no prefix parse function for EQ",
+		"a, b":           "no prefix parse function for COMMA",
+	}
+	for src, want := range tests {
+		_, errs := parseSource(t, src)
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), want) {
+			t.Errorf("%s: got errors %v, want %q", src, errs, want)
+		}
+	}
+}
+
+// TestIndentationWithBraces checks that braces inside an indented block
+// keep their own layout in indentation mode
+func TestIndentationWithBraces(t *testing.T) {
+	src := "with open(path) as f:\n    if y {\n  z =: 2\n    }\n    m =: {\n  a: 1,\n        b: 2,\n    }\nv =: 3\n"
+	program, errs, _ := New(lexer.New(src, lexer.WithIndentation()).Tokenize()).Parse()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("got %d statements, want 2", len(program.Statements))
+	}
+	with, ok := program.Statements[0].(*WithStatement)
+	if !ok || len(with.Body.Statements) != 2 {
+		t.Errorf("got %s, want a with block of 2 statements", program.Statements[0])
+	}
+}
+
+// TestLiterals checks that true, false and null are literals from edition
+// 2026 on, and still plain names in the default edition
+func TestLiterals(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // the type of the assigned value
+	}{
+		{"edition 2026\nx =: true", "*parser.BooleanLiteral"},
+		{"edition 2026\nx =: False", "*parser.BooleanLiteral"},
+		{"edition 2026\nx =: null", "*parser.NullLiteral"},
+		{"edition 2026\nx =: None", "*parser.NullLiteral"},
+		{"x =: true", "*parser.Identifier"},
+		{"x =: null", "*parser.Identifier"},
+	}
+
+	for _, tt := range tests {
+		program, errs := parseSource(t, tt.src)
+		if len(errs) > 0 {
+			t.Errorf("%q: unexpected errors: %v", tt.src, errs)
+			continue
+		}
+		assign, ok := program.Statements[len(program.Statements)-1].(*AssignStatement)
+		if !ok {
+			t.Errorf("%q: got %T, want *AssignStatement", tt.src, program.Statements[0])
+			continue
+		}
+		if got := fmt.Sprintf("%T", assign.Value); got != tt.want {
+			t.Errorf("%q: value is %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+// TestStringValues checks that a string whose value is empty stays empty,
+// and that token files written before strings were decoded still give their
+// text
+func TestStringValues(t *testing.T) {
+	for src, want := range map[string]string{`x =: ""`: "", "x =: \"\\\n\"": "", `x =: "a\tb"`: "a\tb"} {
+		if got := stringValue(t, lexer.New(src).Tokenize()); got != want {
+			t.Errorf("%s: got %q, want %q", src, got, want)
+		}
+	}
+
+	const tokens = `[{"type": "IDENTIFIER", "lexeme": "x"}, {"type": "ASSIGN", "lexeme": "=:"}, {"type": "STRING", "lexeme": %q}, {"type": "EOF"}]`
+	files := []struct{ version, lexeme, want string }{
+		{"", "hi", "hi"}, // legacy bare array
+		{"1", "hi", "hi"},
+		{"2", "\\\n", ""}, // a line continuation, which decodes to nothing
+	}
+	for _, f := range files {
+		data := fmt.Sprintf(tokens, f.lexeme)
+		if f.version != "" {
+			data = fmt.Sprintf(`{"header": {"version": %s}, "tokens": %s}`, f.version, data)
+		}
+		path := filepath.Join(t.TempDir(), "tokens.json")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadTokens(path)
+		if err != nil {
+			t.Fatalf("version %q: %v", f.version, err)
+		}
+		if got := stringValue(t, loaded); got != f.want {
+			t.Errorf("version %q: got %q, want %q", f.version, got, f.want)
+		}
+	}
+}
+
+// stringValue parses tokens for `x =: "..."` and returns the string's value
+func stringValue(t *testing.T, tokens []token.Token) string {
+	t.Helper()
+	program, errs, _ := New(tokens).Parse()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	str, ok := program.Statements[0].(*AssignStatement).Value.(*StringLiteral)
+	if !ok {
+		t.Fatalf("got %T, want *StringLiteral", program.Statements[0].(*AssignStatement).Value)
+	}
+	return str.Value
+}
+
+// TestDocComments checks which declarations a !>> comment attaches to. The
+// doc is read from the last statement in each program.
+func TestDocComments(t *testing.T) {
+	tests := map[string]string{
+		"!>> Adds.\n!>>  Twice.\nfn add(a, b) { return a + b }":  "Adds.\n Twice.",
+		"!>> The analyst\n@agent Analyst { role: \"research\" }": "The analyst",
+		"!>> Builds the report\ntask report { input: data }":     "Builds the report",
+		"!>> Circle constant\nconst PI := 3.14":                  "Circle constant",
+		"!>> Detached\n\nfn f() { return 1 }":                    "",
+		"!>> Not for f\nx =: 1\nfn f() { return 1 }":             "",
+		"!>> On the call\nf()\n":                                 "",
+	}
+	for src, want := range tests {
+		program, errs := parseSource(t, src)
+		if len(errs) > 0 {
+			t.Fatalf("%q: unexpected errors: %v", src, errs)
+		}
+		var doc *DocComment
+		switch s := program.Statements[len(program.Statements)-1].(type) {
+		case *FunctionStatement:
+			doc = s.Doc
+		case *ConstStatement:
+			doc = s.Doc
+		case *AgentDeclaration:
+			doc = s.Doc
+		case *TaskDeclaration:
+			doc = s.Doc
+		}
+		got := ""
+		if doc != nil {
+			got = doc.Text
+		}
+		if got != want {
+			t.Errorf("%q: doc %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestGetNodePosition(t *testing.T) {
+	if line, column := GetNodePosition(nil); line != 0 || column != 0 {
+		t.Errorf("nil node: got %d:%d, want 0:0", line, column)
+	}
+	program, _ := parseSource(t, "\n  x =: 1")
+	if line, column := GetNodePosition(program.Statements[0]); line != 2 || column != 3 {
+		t.Errorf("got %d:%d, want 2:3", line, column)
+	}
+}
+
+// TestInterpolationTooDeep checks that an interpolation the lexer rejected
+// for nesting too deeply isn't reported again by the parser
+func TestInterpolationTooDeep(t *testing.T) {
+	const depth = 9 // one more than the lexer allows
+	src := "x =: " + strings.Repeat(`"${`, depth) + "y" + strings.Repeat(`}"`, depth)
+	l := lexer.New(src)
+	_, errs, _ := New(l.Tokenize()).Parse()
+	if len(l.Errors()) != 1 || l.Errors()[0].Code != lexer.ErrInterpolationDepth {
+		t.Errorf("lexer diagnostics: %v", l.Errors())
+	}
+	if len(errs) > 0 {
+		t.Errorf("unexpected parse errors: %v", errs)
+	}
+}
@@ -0,0 +1,40 @@
+// token/duration.go
+package token
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DurationUnits lists the suffixes of DURATION literals. Longer units come
+// first so "ms" is not read as "m".
+var DurationUnits = []string{"ms", "s", "m", "h", "d"}
+
+var durationScale = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+// ParseDuration converts the lexeme of a DURATION token, such as "120s" or
+// "1.5h", to a time.Duration
+func ParseDuration(lexeme string) (time.Duration, error) {
+	for _, unit := range DurationUnits {
+		if !strings.HasSuffix(lexeme, unit) {
+			continue
+		}
+		number := strings.ReplaceAll(strings.TrimSuffix(lexeme, unit), "_", "")
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", lexeme)
+		}
+		// Round rather than truncate, so 2.3h isn't a nanosecond short
+		return time.Duration(math.Round(value * float64(durationScale[unit]))), nil
+	}
+	return 0, fmt.Errorf("invalid duration %q: missing unit", lexeme)
+}
@@ -0,0 +1,91 @@
+// token/edition.go
+package token
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Edition is a version of the language. Each edition may reserve new
+// keywords; words that were identifiers in older editions keep lexing as
+// identifiers there, so existing programs don't break.
+type Edition int
+
+const (
+	Edition2025 Edition = 2025
+	Edition2026 Edition = 2026
+
+	// DefaultEdition applies to files without an `edition` pragma
+	DefaultEdition = Edition2025
+	// LatestEdition is the newest edition the lexer understands
+	LatestEdition = Edition2026
+)
+
+// EditionKeywords lists the keywords each edition adds on top of Keywords
+// and those of the editions before it
+var EditionKeywords = map[Edition]map[string]TokenType{
+	Edition2025: {},
+	Edition2026: {
+		"true": TRUE, "false": FALSE, "null": NULL,
+		"True": TRUE, "False": FALSE, "None": NULL,
+		"import": IMPORT, "in": IN, "switch": SWITCH,
+	},
+}
+
+// ParseEdition parses an edition year such as "2026"
+func ParseEdition(s string) (Edition, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	_, ok := EditionKeywords[Edition(n)]
+	return Edition(n), ok
+}
+
+// Editions returns the known editions, oldest first
+func Editions() []Edition {
+	editions := make([]Edition, 0, len(EditionKeywords))
+	for e := range EditionKeywords {
+		editions = append(editions, e)
+	}
+	sort.Slice(editions, func(i, j int) bool { return editions[i] < editions[j] })
+	return editions
+}
+
+// LookupKeyword is LookupIdent for a given edition
+func LookupKeyword(ident string, edition Edition) TokenType {
+	tokenType, _ := Keyword(ident, edition)
+	return tokenType
+}
+
+// Keyword is LookupKeyword that also returns the lexeme for the token: the
+// interned spelling for keywords, so their tokens don't keep the source
+// they were lexed from alive, and ident itself for identifiers
+func Keyword(ident string, edition Edition) (TokenType, string) {
+	if kw, ok := keywordTable[ident]; ok && kw.edition <= edition {
+		return kw.tokenType, kw.lexeme
+	}
+	return IDENTIFIER, ident
+}
+
+// keyword is an entry in keywordTable
+type keyword struct {
+	tokenType TokenType
+	lexeme    string
+	edition   Edition // first edition that reserves the word
+}
+
+// keywordTable merges Keywords and EditionKeywords so a lookup is a single
+// map access
+var keywordTable = func() map[string]keyword {
+	table := make(map[string]keyword, len(Keywords))
+	for e, words := range EditionKeywords {
+		for word, tokenType := range words {
+			table[word] = keyword{tokenType, word, e}
+		}
+	}
+	for word, tokenType := range Keywords {
+		table[word] = keyword{tokenType, word, 0}
+	}
+	return table
+}()
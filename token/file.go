@@ -0,0 +1,156 @@
+// token/file.go
+package token
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// FormatVersion is the current version of the token file schema written by
+// synta-lex and read by synta-parse. Files without a header (a bare JSON
+// array of tokens) are treated as version 0. Since version 2, STRING tokens
+// carry their decoded Value; older files only have the Lexeme.
+const FormatVersion = 2
+
+// FileHeader describes where a token stream came from
+type FileHeader struct {
+	Version int    `json:"version"`
+	Source  string `json:"source,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+}
+
+// File is the on-disk interchange format between the lexer and the parser
+type File struct {
+	Header FileHeader `json:"header"`
+	Tokens []Token    `json:"tokens"`
+}
+
+// legacyNames are the token type names of the baseline lexer that were
+// renamed when the token package was shared, for reading its token files
+var legacyNames = map[string]TokenType{
+	"STMT_END": STATEMENT_END,
+	"INT":      INT_TYPE,
+	"CHAR":     CHAR_TYPE,
+	"BOOL":     BOOL_TYPE,
+	"STR":      STR_TYPE,
+	"MAP":      MAP_TYPE,
+	"ARRAY":    ARRAY_TYPE,
+}
+
+var tokenTypesByName = func() map[string]TokenType {
+	m := make(map[string]TokenType, len(TokenNames))
+	for t, name := range TokenNames {
+		m[name] = t
+	}
+	return m
+}()
+
+// LookupName returns the token type registered under name in TokenNames
+func LookupName(name string) (TokenType, bool) {
+	t, ok := tokenTypesByName[name]
+	return t, ok
+}
+
+// HashSource returns the digest stored in FileHeader.Hash for src
+func HashSource(src []byte) string {
+	sum := sha256.Sum256(src)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// NewFile wraps tokens lexed from src in a header for the current format
+func NewFile(source string, src []byte, tokens []Token) *File {
+	return &File{
+		Header: FileHeader{
+			Version: FormatVersion,
+			Source:  source,
+			Hash:    HashSource(src),
+		},
+		Tokens: tokens,
+	}
+}
+
+// DecodeFile parses a token file. Both the versioned format and legacy bare
+// arrays are accepted; legacy files may use integer token types or the type
+// names of the baseline lexer, such as STMT_END (see legacyNames).
+func DecodeFile(data []byte) (*File, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var tokens []Token
+		if err := json.Unmarshal(trimmed, &tokens); err != nil {
+			return nil, err
+		}
+		for i := range tokens {
+			// The baseline lexer named both FLOAT and FLOAT_TYPE "FLOAT"
+			if tokens[i].Type == FLOAT && tokens[i].Lexeme == "float" {
+				tokens[i].Type = FLOAT_TYPE
+			}
+		}
+		decodeLegacyStrings(tokens)
+		return &File{Header: FileHeader{Version: 0}, Tokens: tokens}, nil
+	}
+
+	var f File
+	if err := json.Unmarshal(trimmed, &f); err != nil {
+		return nil, err
+	}
+	if f.Header.Version < 1 || f.Header.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported token file version %d (supported: 1-%d)", f.Header.Version, FormatVersion)
+	}
+	if f.Header.Version < 2 {
+		decodeLegacyStrings(f.Tokens)
+	}
+	return &f, nil
+}
+
+// decodeLegacyStrings fills in the Value of STRING tokens from files written
+// before strings were decoded, whose Lexeme is the text between the quotes
+func decodeLegacyStrings(tokens []Token) {
+	for i := range tokens {
+		if tokens[i].Type == STRING && tokens[i].Value == "" && len(tokens[i].Parts) == 0 {
+			tokens[i].Value = tokens[i].Lexeme
+		}
+	}
+}
+
+// MarshalJSON writes the token type by name, e.g. "IDENTIFIER"
+func (t TokenType) MarshalJSON() ([]byte, error) {
+	name, ok := TokenNames[t]
+	if !ok {
+		return nil, fmt.Errorf("unknown token type %d", int(t))
+	}
+	return json.Marshal(name)
+}
+
+// UnmarshalJSON reads a token type by name, falling back to the legacy
+// names and integer encoding
+func (t *TokenType) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var name string
+		if err := json.Unmarshal(data, &name); err != nil {
+			return err
+		}
+		tt, ok := LookupName(name)
+		if !ok {
+			tt, ok = legacyNames[name]
+		}
+		if !ok {
+			return fmt.Errorf("unknown token type %q", name)
+		}
+		*t = tt
+		return nil
+	}
+
+	n, err := strconv.Atoi(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid token type %s", data)
+	}
+	if _, ok := TokenNames[TokenType(n)]; !ok {
+		return fmt.Errorf("unknown token type %d", n)
+	}
+	*t = TokenType(n)
+	return nil
+}
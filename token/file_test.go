@@ -0,0 +1,38 @@
+package token
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDecodeBaselineFile decodes tokens as the baseline analyzer server wrote
+// them, with its type names
+func TestDecodeBaselineFile(t *testing.T) {
+	data := `[
+		{"lexeme": "bind", "type": "BIND", "line": 1, "column": 1},
+		{"lexeme": "x", "type": "IDENTIFIER", "line": 1, "column": 6},
+		{"lexeme": ":", "type": "COLON", "line": 1, "column": 7},
+		{"lexeme": "float", "type": "FLOAT", "line": 1, "column": 9},
+		{"lexeme": ":=", "type": "BIND_ASSIGN", "line": 1, "column": 15},
+		{"lexeme": "1.5", "type": "FLOAT", "line": 1, "column": 18},
+		{"lexeme": ";", "type": "STMT_END", "line": 1, "column": 21},
+		{"lexeme": "int", "type": "INT", "line": 2, "column": 1},
+		{"lexeme": "str", "type": "STR", "line": 2, "column": 5},
+		{"lexeme": "", "type": "EOF", "line": 2, "column": 8}
+	]`
+	f, err := DecodeFile([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []TokenType
+	for _, tok := range f.Tokens {
+		got = append(got, tok.Type)
+	}
+	want := []TokenType{BIND, IDENTIFIER, COLON, FLOAT_TYPE, BIND_ASSIGN, FLOAT, STATEMENT_END, INT_TYPE, STR_TYPE, EOF}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("token types:\n got %v\nwant %v", got, want)
+	}
+	if f.Header.Version != 0 || f.Tokens[5].Lexeme != "1.5" || f.Tokens[6].Line != 1 || f.Tokens[6].Column != 21 {
+		t.Errorf("got %+v", f)
+	}
+}
@@ -0,0 +1,17 @@
+// token/offsets.go
+package token
+
+// Offsets is the compact form of a token: its type and the byte range
+// [Start, End) it covers in the source. It is 16 bytes against a Token's
+// 200, for tools that only need to know where the tokens are; the text is
+// src[Start:End] and lines and columns can be recomputed from the source.
+type Offsets struct {
+	Type  TokenType `json:"type"`
+	Start int32     `json:"start"`
+	End   int32     `json:"end"`
+}
+
+// Text returns the token's source text
+func (o Offsets) Text(src string) string {
+	return src[o.Start:o.End]
+}
@@ -1,4 +1,5 @@
-package parser
+// token/token.go
+package token
 
 type TokenType int
 
@@ -203,6 +204,28 @@ const (
 	ILLEGAL
 )
 
+// Token types added after the first token file format. They are numbered
+// after ILLEGAL so the integer values in legacy token files stay valid.
+const (
+	DURATION    TokenType = iota + ILLEGAL + 1 // 120s, 500ms, 1.5h
+	WHITESPACE                                 // spaces and tabs, only as trivia
+	DOC_COMMENT                                // !>> documents the declaration below
+	EDITION                                    // edition 2026 pragma
+
+	// Keywords added by later editions, see EditionKeywords
+	TRUE
+	FALSE
+	NULL
+	IMPORT
+	IN
+	SWITCH
+
+	INDENT // opens an indented block, only in indentation mode
+	DEDENT // closes an indented block
+
+	SHELL_DIRECTIVE // !pip install unsloth, at the start of a line
+)
+
 var TokenNames = map[TokenType]string{
 	IDENTIFIER: "IDENTIFIER", INTEGER: "INTEGER", FLOAT: "FLOAT", STRING: "STRING",
 	IF: "IF", ELIF: "ELIF", ELSE: "ELSE", WHILE: "WHILE", FOR: "FOR",
@@ -211,8 +234,8 @@ var TokenNames = map[TokenType]string{
 	BIND: "BIND", CONST: "CONST", CRAFT: "CRAFT", USE: "USE", AS: "AS", FROM: "FROM",
 	FN: "FN", STRUCT: "STRUCT", TRY: "TRY", CATCH: "CATCH", RAISE: "RAISE",
 	TYPE: "TYPE", CAST: "CAST", ANY: "ANY", NONE: "NONE", TRAIT: "TRAIT",
-	INT_TYPE: "INT", FLOAT_TYPE: "FLOAT", CHAR_TYPE: "CHAR",
-	BOOL_TYPE: "BOOL", STR_TYPE: "STR", MAP_TYPE: "MAP", ARRAY_TYPE: "ARRAY",
+	INT_TYPE: "INT_TYPE", FLOAT_TYPE: "FLOAT_TYPE", CHAR_TYPE: "CHAR_TYPE",
+	BOOL_TYPE: "BOOL_TYPE", STR_TYPE: "STR_TYPE", MAP_TYPE: "MAP_TYPE", ARRAY_TYPE: "ARRAY_TYPE",
 	ASYNC: "ASYNC", EMIT: "EMIT", LISTEN: "LISTEN", DISPATCH: "DISPATCH", MERGE: "MERGE",
 	TASK: "TASK", CONCURRENT: "CONCURRENT", STAGE: "STAGE",
 	WITH: "WITH", THEN: "THEN", DEFER: "DEFER", PIPE: "PIPE", PASS: "PASS",
@@ -244,9 +267,13 @@ var TokenNames = map[TokenType]string{
 	DOLLAR: "DOLLAR", PIPE_OP: "PIPE_OP",
 	LPAREN: "LPAREN", RPAREN: "RPAREN", LBRACKET: "LBRACKET", RBRACKET: "RBRACKET",
 	LBRACE: "LBRACE", RBRACE: "RBRACE", SEMICOLON: "SEMICOLON", COMMA: "COMMA",
-	COLON: "COLON", DOT: "DOT", STATEMENT_END: "STMT_END",
+	COLON: "COLON", DOT: "DOT", STATEMENT_END: "STATEMENT_END",
 	COMMENT_LINE: "COMMENT_LINE", COMMENT_MULTI: "COMMENT_MULTI",
 	NEWLINE: "NEWLINE", EOF: "EOF", ILLEGAL: "ILLEGAL",
+	DURATION: "DURATION", WHITESPACE: "WHITESPACE", DOC_COMMENT: "DOC_COMMENT",
+	EDITION: "EDITION", TRUE: "TRUE", FALSE: "FALSE", NULL: "NULL",
+	IMPORT: "IMPORT", IN: "IN", SWITCH: "SWITCH", INDENT: "INDENT", DEDENT: "DEDENT",
+	SHELL_DIRECTIVE: "SHELL_DIRECTIVE",
 }
 
 var Keywords = map[string]TokenType{
@@ -303,10 +330,47 @@ var Keywords = map[string]TokenType{
 }
 
 type Token struct {
-	Type   TokenType
-	Lexeme string
-	Line   int
-	Column int
+	Type        TokenType `json:"type"`
+	Lexeme      string    `json:"lexeme"`
+	Line        int       `json:"line"`
+	Column      int       `json:"column"`                 // in runes
+	UTF16Column int       `json:"utf16_column,omitempty"` // in UTF-16 code units
+	Span        Span      `json:"span"`
+
+	// Value is the decoded contents of a STRING token (escapes resolved)
+	Value string `json:"value,omitempty"`
+	// Parts is set on STRING tokens that contain ${...} interpolations
+	Parts []StringPart `json:"parts,omitempty"`
+	// Raw is the token's exact source text when it differs from Lexeme. It
+	// and the trivia fields are only filled in by a lossless lexer.
+	Raw            string   `json:"raw,omitempty"`
+	LeadingTrivia  []Trivia `json:"leading_trivia,omitempty"`
+	TrailingTrivia []Trivia `json:"trailing_trivia,omitempty"`
+}
+
+// Pos is a location in the source. Offset is in bytes, Line and Column are
+// 1-based and Column counts runes.
+type Pos struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Span is the half-open source range [Start, End) covered by a token or node
+type Span struct {
+	Start Pos `json:"start"`
+	End   Pos `json:"end"`
+}
+
+// StringPart is one piece of an interpolated string: literal text, or the
+// tokens lexed from a ${...} expression
+type StringPart struct {
+	Text   string  `json:"text,omitempty"`
+	Expr   bool    `json:"expr,omitempty"`
+	Tokens []Token `json:"tokens,omitempty"`
+	// Rejected marks an expression the lexer reported and didn't lex, such
+	// as one nested too deeply
+	Rejected bool `json:"rejected,omitempty"`
 }
 
 func LookupIdent(ident string) TokenType {
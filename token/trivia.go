@@ -0,0 +1,39 @@
+// token/trivia.go
+package token
+
+import "strings"
+
+// Trivia is source text that carries no meaning for the parser: whitespace
+// and comments. Type is WHITESPACE, COMMENT_LINE or COMMENT_MULTI.
+//
+// A token's trailing trivia runs up to the end of its line; anything after
+// that (indentation, comments on their own line) leads the next token.
+// NEWLINE tokens never have trailing trivia.
+type Trivia struct {
+	Type TokenType `json:"type"`
+	Text string    `json:"text"`
+}
+
+// Text returns the token's exact source text
+func (t Token) Text() string {
+	if t.Raw != "" {
+		return t.Raw
+	}
+	return t.Lexeme
+}
+
+// Source reassembles the original input from tokens produced by a lossless
+// lexer, trivia included
+func Source(tokens []Token) string {
+	var b strings.Builder
+	for _, tok := range tokens {
+		for _, tr := range tok.LeadingTrivia {
+			b.WriteString(tr.Text)
+		}
+		b.WriteString(tok.Text())
+		for _, tr := range tok.TrailingTrivia {
+			b.WriteString(tr.Text)
+		}
+	}
+	return b.String()
+}